@@ -0,0 +1,121 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// accessRequestCooldown 是访问申请被拒绝后再次申请前需要等待的时间, 避免反复打扰管理员
+const accessRequestCooldown = 24 * time.Hour
+
+// handleAccessRequest 记录非白名单用户的访问申请, 并通知所有管理员
+func (a *Atri) handleAccessRequest(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, username string) {
+	last, err := a.store.GetLastAccessRequest(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+	if err == nil {
+		switch {
+		case last.Status == AccessRequestPending:
+			a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "access.pending"), false)
+			return
+		case last.Status == AccessRequestDenied && time.Since(last.UpdatedAt) < accessRequestCooldown:
+			retryAt := last.UpdatedAt.Add(accessRequestCooldown).In(a.userLocation(ctx, userID))
+			a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "access.cooldown", retryAt.Format(time.DateTime)), false)
+			return
+		}
+	}
+
+	request := &AccessRequestRecord{
+		UserID:   userID,
+		ChatID:   chatID,
+		Username: username,
+		Status:   AccessRequestPending,
+	}
+	err = a.store.CreateAccessRequest(ctx, request)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+
+	admins, err := a.store.ListAdmins(ctx)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+
+	for _, admin := range admins {
+		// 使用管理员的语言
+		adminCtx := withLanguage(ctx, a.resolveLanguage(ctx, admin.UserID, ""))
+		keyboard := [][]models.InlineKeyboardButton{{
+			newCallbackData(callbackAccess, "approve", request.ID).button(a.t(adminCtx, "access.approve")),
+			newCallbackData(callbackAccess, "deny", request.ID).button(a.t(adminCtx, "access.deny")),
+		}}
+		_, err := a.sendMessageWithKeyboard(ctx, bt, admin.UserID, a.t(adminCtx, "access.notice", username, userID), keyboard)
+		if err != nil {
+			a.logger.Error("通知管理员失败", zap.Int64("AdminID", admin.UserID), zap.Error(err))
+		}
+	}
+
+	a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "access.submitted", userID), false)
+}
+
+// handleAccessCallback 处理管理员点击的批准/拒绝按钮
+func (a *Atri) handleAccessCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	adminID := query.From.ID
+
+	if !a.requirePermission(ctx, adminID, PermManageUsers, "access.decide") {
+		return a.t(ctx, "access.no_permission"), nil
+	}
+
+	action := data.arg(0)
+	requestID, err := data.uintArg(1)
+	if err != nil || (action != "approve" && action != "deny") {
+		return a.t(ctx, "invalid_action"), nil
+	}
+	approve := action == "approve"
+
+	request, err := a.store.DecideAccessRequest(ctx, requestID, adminID, approve)
+	if !errors.Is(err, ErrAccessRequestDecided) {
+		a.audit(ctx, adminID, "access."+action, request.UserID, "", auditOutcome(err))
+	}
+	if errors.Is(err, ErrAccessRequestDecided) {
+		return a.t(ctx, "access.decided"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	a.logger.Info("访问申请已处理",
+		zap.Int64("AdminID", adminID),
+		zap.Int64("UserID", request.UserID),
+		zap.String("Status", request.Status),
+	)
+
+	// 通知使用申请者的语言
+	userCtx := withLanguage(ctx, a.resolveLanguage(ctx, request.UserID, ""))
+	result := a.t(ctx, "access.denied")
+	userNotice := a.t(userCtx, "access.denied.notice")
+	if approve {
+		result = a.t(ctx, "access.approved")
+		userNotice = a.t(userCtx, "access.approved.notice")
+	}
+
+	msg := query.Message.Message
+	text := a.t(ctx, "access.decided_by", msg.Text, result, adminID)
+	if _, err := a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, text, nil); err != nil {
+		a.logger.Error("更新申请消息失败", zap.Error(err))
+	}
+
+	if _, err := a.sendMessageTo(ctx, bt, request.ChatID, userNotice, false); err != nil {
+		a.logger.Error("通知申请用户失败", zap.Int64("UserID", request.UserID), zap.Error(err))
+	}
+
+	return result, nil
+}
@@ -4,50 +4,104 @@ package atri
 import (
 	"context"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/openai/openai-go/v3"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 // Config 用于配置Atri实例的模型、最大保留轮数和系统提示词
 type Config struct {
-	Model            string
-	MaxRounds        int
+	Model     string
+	MaxRounds int
+	// SystemPrompt 是text/template格式的系统提示词, 可用的数据见PromptData; 旧的{{USERNAME}}/{{MEMORIES}}占位符仍然可用
 	SystemPrompt     string
 	CheckInitTimeout time.Duration
+	Prices           map[string]ModelPrice // 按模型名配置的价格表, 未配置的模型费用记为0
+	DefaultQuota     Quota                 // 所有用户的默认额度, 可被管理员按用户覆盖
+	EnableSearchTool bool                  // 是否向模型提供search_history工具, 用于查找MaxRounds之外的历史对话
+	Retention        Retention             // 对话、记忆和审计日志的保留策略, 零值表示永久保留
+	// EncryptionKeys 是用于加密对话和记忆内容的AES密钥(16/24/32字节), 为空时不加密.
+	// 第一个密钥用于加密, 其余的只用于解密; 轮换时将新密钥放在最前面并保留旧密钥.
+	// 启动时会加密已有的明文, 并使用第一个密钥重新加密其他密钥加密的数据
+	EncryptionKeys [][]byte
+	// TracerProvider 用于创建链路追踪的Span, 为nil时使用otel的全局TracerProvider
+	TracerProvider trace.TracerProvider
+	Bootstrap      Bootstrap // 如何产生最初的管理员
+	// Language 是默认语言(zh/en), 用户没有设置语言且Telegram的language_code不受支持时使用, 默认为zh
+	Language string
+	// Messages 按语言覆盖消息目录中的文本: 语言 -> 消息键 -> 文本, 也可以用来添加新的语言
+	Messages map[string]map[string]string
+	// Roles 覆盖内置角色(admin/user/guest)的权限或添加新的角色
+	Roles map[string][]Permission
+	// Persona 是Bot的人设名称, 在系统提示词中通过{{.Persona}}使用
+	Persona string
+	// PromptVars 是运营者自定义的变量, 在系统提示词中通过{{.Vars.名称}}使用
+	PromptVars map[string]any
+}
+
+// ModelPrice 是某个模型每百万Token的价格
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
 }
 
 // Atri 是Atri的实例
 type Atri struct {
 	ctx             context.Context
 	logger          *zap.Logger
-	db              *gorm.DB
+	store           Store
 	openaiClient    *openai.Client
 	bot             *bot.Bot
 	botToken        string
 	config          Config
 	userSession     map[int64]*userSession
-	userSessionLock sync.Mutex
+	userSessionLock sync.Mutex // 只保护userSession和userChatLocks这两个map, 会话本身的字段由userSession.lock保护
+	// userChatLocks 是每个用户的对话锁, 不随会话一起丢弃, 重置会话时正在进行的对话仍然会阻塞后续的对话
+	userChatLocks  map[int64]*sync.Mutex
+	messageLimiter *rateLimiter
+	deniedLimiter  *rateLimiter // 限制每个用户写入access.denied审计日志的频率
+	bannedLimiter  *rateLimiter // 限制被封禁用户的审计日志和通知的频率
+	metrics        *metrics
+	tracer         trace.Tracer
+	setupToken     setupToken
+	systemPrompt   *template.Template
 }
 
-// New 创建一个新的Atri实例
-func New(ctx context.Context, logger *zap.Logger, openaiClient *openai.Client, db *gorm.DB, botToken string, cfg Config) *Atri {
+// New 创建一个新的Atri实例, store可以使用NewGormStore或NewMemoryStore创建
+func New(ctx context.Context, logger *zap.Logger, openaiClient *openai.Client, store Store, botToken string, cfg Config) *Atri {
+	tracer := newTracer(cfg.TracerProvider)
+
 	return &Atri{
-		ctx:          ctx,
-		logger:       logger.Named("Atri"),
-		db:           db,
-		openaiClient: openaiClient,
-		botToken:     botToken,
-		config:       cfg,
-		userSession:  make(map[int64]*userSession),
+		ctx:            ctx,
+		logger:         logger.Named("Atri"),
+		store:          newTracedStore(store, tracer),
+		openaiClient:   openaiClient,
+		botToken:       botToken,
+		config:         cfg,
+		userSession:    make(map[int64]*userSession),
+		userChatLocks:  make(map[int64]*sync.Mutex),
+		messageLimiter: newRateLimiter(),
+		deniedLimiter:  newRateLimiter(),
+		bannedLimiter:  newRateLimiter(),
+		metrics:        newMetrics(),
+		tracer:         tracer,
 	}
 }
 
 // Start 启动Telegram Bot并返回一个在停止时关闭的通道
 func (a *Atri) Start() (<-chan struct{}, error) {
+	if err := a.setupSystemPrompt(); err != nil {
+		return nil, err
+	}
+
+	if err := a.setupEncryption(); err != nil {
+		return nil, err
+	}
+
 	if err := a.setupBot(); err != nil {
 		return nil, err
 	}
@@ -56,6 +110,14 @@ func (a *Atri) Start() (<-chan struct{}, error) {
 		return nil, err
 	}
 
+	if err := a.setupBootstrap(); err != nil {
+		return nil, err
+	}
+
+	a.startRetentionLoop()
+	a.startReminderLoop()
+	a.startScheduleLoop()
+
 	closeCh := make(chan struct{})
 	go func() {
 		a.bot.Start(a.ctx)
@@ -0,0 +1,118 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+const (
+	auditDefaultCount     = 20               // /audit 默认显示的条数
+	auditMaxCount         = 100              // /audit 最多显示的条数
+	auditMaxArgsLength    = 200              // /audit 中每条日志的参数最多显示的字符数
+	accessDeniedAuditWait = 10 * time.Minute // 同一用户两条access.denied或access.banned审计日志的最小间隔
+)
+
+// auditOutcome 根据操作的错误返回审计结果
+func auditOutcome(err error) string {
+	if err != nil {
+		return AuditFailed
+	}
+	return AuditSuccess
+}
+
+// audit 写入一条审计日志, 写入失败时只记录日志, 不影响正常流程
+func (a *Atri) audit(ctx context.Context, actorID int64, action string, targetID int64, args string, outcome string) {
+	record := &AuditRecord{
+		ActorID:  actorID,
+		Action:   action,
+		TargetID: targetID,
+		Args:     args,
+		Outcome:  outcome,
+	}
+
+	if err := a.store.CreateAudit(ctx, record); err != nil {
+		a.logger.Error("写入审计日志失败",
+			zap.Int64("ActorID", actorID),
+			zap.String("Action", action),
+			zap.Error(err),
+		)
+	}
+}
+
+// auditAccessDenied 记录白名单外用户的访问, 同一用户在accessDeniedAuditWait内只记录一次, 避免刷屏写满审计日志
+func (a *Atri) auditAccessDenied(ctx context.Context, userID int64, args string) {
+	if ok, _ := a.deniedLimiter.allow(userID, 1, accessDeniedAuditWait); !ok {
+		return
+	}
+	a.audit(ctx, userID, "access.denied", userID, args, AuditDenied)
+}
+
+func (a *Atri) handleAudit(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if !a.requirePermission(ctx, userID, PermViewAudit, "audit") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
+		return err
+	}
+
+	count := auditDefaultCount
+	if len(args) >= 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "audit.usage"), false)
+			return err
+		}
+		count = min(n, auditMaxCount)
+	}
+
+	records, err := a.store.ListRecentAudits(ctx, count)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "audit.empty"), false)
+		return err
+	}
+
+	// 超出Telegram的消息长度限制时只显示能放下的最近几条
+	var sb strings.Builder
+	shown := 0
+	for _, r := range records {
+		line := formatAuditRecord(r)
+		if messageLength(a.t(ctx, "audit.list", shown+1, sb.String()+line)+a.t(ctx, "audit.truncated", len(records))) > telegramMaxMessageLength {
+			break
+		}
+		sb.WriteString(line)
+		shown++
+	}
+
+	msg := a.t(ctx, "audit.list", shown, sb.String())
+	if shown < len(records) {
+		msg += a.t(ctx, "audit.truncated", len(records))
+	}
+	_, err = a.sendMessageTo(ctx, bt, chatID, msg, false)
+	return err
+}
+
+// formatAuditRecord 将一条审计日志格式化为一行, 过长的参数会被截断
+func formatAuditRecord(r AuditRecord) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %d %s", r.CreatedAt.Format(time.DateTime), r.ActorID, r.Action)
+	if r.TargetID != 0 {
+		fmt.Fprintf(&sb, " -> %d", r.TargetID)
+	}
+	if r.Args != "" {
+		args := []rune(r.Args)
+		if len(args) > auditMaxArgsLength {
+			args = append(args[:auditMaxArgsLength], []rune("...")...)
+		}
+		fmt.Fprintf(&sb, " (%s)", string(args))
+	}
+	fmt.Fprintf(&sb, " %s\n", r.Outcome)
+	return sb.String()
+}
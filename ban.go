@@ -0,0 +1,150 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// activeBan 返回用户当前有效的封禁, 没有封禁时返回nil. 过期的封禁会自动失效
+func (a *Atri) activeBan(ctx context.Context, userID int64) (*BanRecord, error) {
+	ban, err := a.store.GetActiveBan(ctx, userID, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// banDescription 描述封禁的期限和原因
+func (a *Atri) banDescription(ctx context.Context, ban *BanRecord) string {
+	until := a.t(ctx, "ban.forever")
+	if ban.ExpiresAt != nil {
+		until = a.t(ctx, "ban.until", ban.ExpiresAt.Format(time.DateTime))
+	}
+	if ban.Reason == "" {
+		return until
+	}
+	return a.t(ctx, "ban.with_reason", until, ban.Reason)
+}
+
+// checkBanned 判断用户是否被封禁, 被封禁时通知用户并返回true.
+// 同一用户在accessDeniedAuditWait内只记录一次审计日志并通知一次, 避免刷屏
+func (a *Atri) checkBanned(ctx context.Context, bt *bot.Bot, chatID int64, userID int64) bool {
+	ban, err := a.activeBan(ctx, userID)
+	if err != nil {
+		a.logger.Error("加载封禁记录失败", zap.Int64("UserID", userID), zap.Error(err))
+		return false
+	}
+	if ban == nil {
+		return false
+	}
+
+	if ok, _ := a.bannedLimiter.allow(userID, 1, accessDeniedAuditWait); !ok {
+		return true
+	}
+
+	a.audit(ctx, userID, "access.banned", userID, "", AuditDenied)
+	a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.notice", a.banDescription(ctx, ban)), false)
+	return true
+}
+
+// handleUserBan 封禁用户: /user ban <ID> [时长] [原因], 不指定时长时为永久封禁
+func (a *Atri) handleUserBan(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) < 1 {
+		return a.handleUserBanList(ctx, bt, chatID)
+	}
+
+	targetID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.usage"), false)
+		return err
+	}
+	if targetID == userID {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.self"), false)
+		return err
+	}
+	if !a.canManageUser(ctx, userID, targetID) {
+		a.audit(ctx, userID, "user.ban", targetID, strings.Join(args[1:], " "), AuditDenied)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.above_self"), false)
+		return err
+	}
+
+	ban := &BanRecord{UserID: targetID, BannedBy: userID}
+	rest := args[1:]
+	if len(rest) > 0 {
+		if d, err := parseDuration(rest[0]); err == nil {
+			expiresAt := time.Now().Add(d)
+			ban.ExpiresAt = &expiresAt
+			rest = rest[1:]
+		}
+	}
+	ban.Reason = strings.Join(rest, " ")
+
+	err = a.store.SaveBan(ctx, ban)
+	a.audit(ctx, userID, "user.ban", targetID, strings.Join(args[1:], " "), auditOutcome(err))
+	if err != nil {
+		return err
+	}
+
+	a.logger.Info("封禁了用户",
+		zap.Int64("AdminID", userID),
+		zap.Int64("UserID", targetID),
+		zap.String("Reason", ban.Reason),
+	)
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.success", targetID, a.banDescription(ctx, ban)), false)
+	return err
+}
+
+// handleUserBanList 列出所有有效的封禁
+func (a *Atri) handleUserBanList(ctx context.Context, bt *bot.Bot, chatID int64) error {
+	bans, err := a.store.ListActiveBans(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(bans) == 0 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.empty"), false)
+		return err
+	}
+
+	var sb strings.Builder
+	for _, b := range bans {
+		fmt.Fprintf(&sb, "ID: %d - %s\n", b.UserID, a.banDescription(ctx, &b))
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "ban.list", sb.String()), false)
+	return err
+}
+
+// handleUserUnban 解除封禁: /user unban <ID>
+func (a *Atri) handleUserUnban(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) < 1 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "unban.missing_id"), false)
+		return err
+	}
+
+	targetID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
+		return err
+	}
+
+	err = a.store.DeleteBan(ctx, targetID)
+	a.audit(ctx, userID, "user.unban", targetID, "", auditOutcome(err))
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "unban.success"), false)
+	return err
+}
@@ -0,0 +1,104 @@
+package atri
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// Bootstrap 配置如何产生最初的管理员, 零值表示不会自动产生任何管理员
+type Bootstrap struct {
+	AdminIDs []int64 // 启动时确保这些用户在白名单内且为管理员
+	// SetupToken 为true时, 如果启动时没有任何管理员, 会生成一个一次性的设置令牌并打印到日志,
+	// 用户发送 /start <令牌> 即可成为管理员
+	SetupToken bool
+	// AutoPromoteFirstUser 为true时, 白名单为空时第一个发送消息的用户会成为管理员. 不建议在公开的Bot上使用
+	AutoPromoteFirstUser bool
+}
+
+// setupToken 是一次性的设置令牌, 使用后即失效
+type setupToken struct {
+	lock  sync.Mutex
+	token string
+}
+
+// consume 校验并消耗令牌, 令牌只能成功使用一次
+func (t *setupToken) consume(token string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.token == "" || subtle.ConstantTimeCompare([]byte(t.token), []byte(token)) != 1 {
+		return false
+	}
+	t.token = ""
+	return true
+}
+
+// setupBootstrap 按Bootstrap配置创建管理员或生成设置令牌, 在数据库初始化之后调用
+func (a *Atri) setupBootstrap() error {
+	ctx := a.ctx
+	cfg := a.config.Bootstrap
+
+	for _, adminID := range cfg.AdminIDs {
+		if err := a.ensureAdmin(ctx, adminID); err != nil {
+			return err
+		}
+		a.audit(ctx, 0, "bootstrap.admin", adminID, "config", AuditSuccess)
+	}
+
+	if !cfg.SetupToken {
+		return nil
+	}
+
+	admins, err := a.store.ListAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {
+		return nil
+	}
+
+	a.setupToken.lock.Lock()
+	a.setupToken.token = randomToken(16)
+	a.logger.Warn("没有任何管理员, 请向Bot发送 /start <令牌> 成为管理员", zap.String("Token", a.setupToken.token))
+	a.setupToken.lock.Unlock()
+
+	return nil
+}
+
+// ensureAdmin 确保用户在白名单内且为管理员
+func (a *Atri) ensureAdmin(ctx context.Context, userID int64) error {
+	user, err := a.store.GetUser(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return a.store.CreateUser(ctx, userID, true)
+	}
+	if err != nil {
+		return err
+	}
+	if user.IsAdmin {
+		return nil
+	}
+	return a.store.UpdateUserAdmin(ctx, userID, true)
+}
+
+// handleSetupToken 尝试将 /start 的参数作为设置令牌使用, 令牌不正确时返回false
+func (a *Atri) handleSetupToken(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, token string) bool {
+	if !a.setupToken.consume(token) {
+		return false
+	}
+
+	err := a.ensureAdmin(ctx, userID)
+	a.audit(ctx, userID, "bootstrap.admin", userID, "setup_token", auditOutcome(err))
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return true
+	}
+
+	a.logger.Info("通过设置令牌创建了管理员", zap.Int64("UserID", userID))
+	a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "bootstrap.admin"), false)
+	return true
+}
@@ -1,14 +1,30 @@
 package atri
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"unicode/utf16"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"go.uber.org/zap"
 )
 
+// telegramMaxMessageLength 是Telegram单条消息的最大长度, 按UTF-16编码单元计算
+const telegramMaxMessageLength = 4096
+
+// isPermanentSendError 判断发送消息的错误是否无法通过重试恢复, 如用户屏蔽了Bot(403)或聊天不存在(400)
+func isPermanentSendError(err error) bool {
+	return errors.Is(err, bot.ErrorForbidden) || errors.Is(err, bot.ErrorBadRequest) || errors.Is(err, bot.ErrorNotFound)
+}
+
+// messageLength 按Telegram的方式计算消息的长度
+func messageLength(msg string) int {
+	return len(utf16.Encode([]rune(msg)))
+}
+
 func (a *Atri) sendMessageTo(ctx context.Context, bt *bot.Bot, chatID int64, msg string, isMarkdown bool) (*models.Message, error) {
 	param := &bot.SendMessageParams{
 		ChatID: chatID,
@@ -20,6 +36,57 @@ func (a *Atri) sendMessageTo(ctx context.Context, bt *bot.Bot, chatID int64, msg
 	return bt.SendMessage(ctx, param)
 }
 
+func (a *Atri) sendMessageWithKeyboard(ctx context.Context, bt *bot.Bot, chatID int64, msg string, keyboard [][]models.InlineKeyboardButton) (*models.Message, error) {
+	param := &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   msg,
+	}
+	if keyboard != nil {
+		param.ReplyMarkup = &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+	return bt.SendMessage(ctx, param)
+}
+
+// editMessageText 编辑消息内容, keyboard为nil时移除按钮
+func (a *Atri) editMessageText(ctx context.Context, bt *bot.Bot, chatID int64, messageID int, msg string, keyboard [][]models.InlineKeyboardButton) (*models.Message, error) {
+	param := &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      msg,
+	}
+	if keyboard != nil {
+		param.ReplyMarkup = &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+	return bt.EditMessageText(ctx, param)
+}
+
+func (a *Atri) editMessageKeyboard(ctx context.Context, bt *bot.Bot, chatID int64, messageID int, keyboard [][]models.InlineKeyboardButton) error {
+	_, err := bt.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+
+	return err
+}
+
+func (a *Atri) answerCallbackQuery(ctx context.Context, bt *bot.Bot, callbackQueryID string, text string) error {
+	_, err := bt.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: callbackQueryID,
+		Text:            text,
+	})
+
+	return err
+}
+
+func (a *Atri) sendDocument(ctx context.Context, bt *bot.Bot, chatID int64, filename string, data []byte, caption string) (*models.Message, error) {
+	return bt.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: filename, Data: bytes.NewReader(data)},
+		Caption:  caption,
+	})
+}
+
 func (a *Atri) sendChatAction(ctx context.Context, bt *bot.Bot, chatID int64, newAction models.ChatAction) error {
 	_, err := bt.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: chatID,
@@ -31,6 +98,7 @@ func (a *Atri) sendChatAction(ctx context.Context, bt *bot.Bot, chatID int64, ne
 
 func (a *Atri) sendError(ctx context.Context, bt *bot.Bot, chatID int64, err error) {
 	a.logger.Info("发送错误", zap.Error(err))
+	a.metrics.errors.WithLabelValues(errorType(err)).Inc()
 
 	format := `>_< Fatal Error !
 %s`
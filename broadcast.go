@@ -0,0 +1,149 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	broadcastInterval    = 50 * time.Millisecond // 两条广播消息之间的间隔, Telegram限制每秒最多约30条
+	broadcastMaxFailures = 20                    // 汇总中最多列出的失败用户数
+)
+
+// broadcastFailure 是一次投递失败
+type broadcastFailure struct {
+	UserID int64
+	Err    error
+}
+
+// handleBroadcast 预览要广播的消息, 确认后发送给所有白名单用户
+func (a *Atri) handleBroadcast(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
+	if !a.requirePermission(ctx, userID, PermBroadcast, "broadcast") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
+		return err
+	}
+
+	// 使用原始文本, 保留引号和换行
+	text := commandText(ctx)
+	if text == "" {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "broadcast.usage"), false)
+		return err
+	}
+
+	recipients, err := a.broadcastRecipients(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "broadcast.preview", len(recipients)), false)
+	if err != nil {
+		return err
+	}
+
+	// 预览消息的内容就是要广播的内容, 确认时直接读取, 不需要额外保存
+	_, err = a.sendMessageWithKeyboard(ctx, bt, chatID, text, a.confirmKeyboard(ctx, newCallbackData(callbackBroadcast)))
+	return err
+}
+
+func (a *Atri) handleBroadcastCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, _ callbackData) (string, error) {
+	adminID := query.From.ID
+	if !a.requirePermission(ctx, adminID, PermBroadcast, "broadcast") {
+		return a.t(ctx, "no_permission_action"), nil
+	}
+
+	// 先移除按钮, 移除失败说明按钮已经被点击过, 避免重复发送
+	msg := query.Message.Message
+	if err := a.editMessageKeyboard(ctx, bt, msg.Chat.ID, msg.ID, [][]models.InlineKeyboardButton{}); err != nil {
+		a.logger.Warn("移除广播按钮失败", zap.Error(err))
+		return a.t(ctx, "broadcast.already_sent"), nil
+	}
+
+	// 投递可能需要较长时间, 不阻塞回调的处理; 汇总使用管理员的语言
+	go a.deliverBroadcast(withLanguage(a.ctx, a.resolveLanguage(ctx, adminID, query.From.LanguageCode)), bt, msg.Chat.ID, adminID, msg.Text)
+
+	return a.t(ctx, "broadcast.started"), nil
+}
+
+// broadcastRecipients 返回白名单中的所有用户ID, 同一用户有多条记录时只出现一次
+func (a *Atri) broadcastRecipients(ctx context.Context) ([]int64, error) {
+	users, err := a.store.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int64]bool{}
+	recipients := []int64{}
+	for _, u := range users {
+		if !seen[u.UserID] {
+			seen[u.UserID] = true
+			recipients = append(recipients, u.UserID)
+		}
+	}
+	return recipients, nil
+}
+
+// deliverBroadcast 按间隔将消息逐个发送给白名单内未被封禁的用户, 完成后向管理员发送汇总
+func (a *Atri) deliverBroadcast(ctx context.Context, bt *bot.Bot, chatID int64, adminID int64, text string) {
+	recipients, err := a.broadcastRecipients(ctx)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+
+	sent, skipped := 0, 0
+	failures := []broadcastFailure{}
+	for _, recipientID := range recipients {
+		ban, err := a.activeBan(ctx, recipientID)
+		if err == nil && ban != nil {
+			skipped++
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 私聊的ChatID与UserID相同
+		if _, err := a.sendMessageTo(ctx, bt, recipientID, text, false); err != nil {
+			failures = append(failures, broadcastFailure{UserID: recipientID, Err: err})
+			continue
+		}
+		sent++
+	}
+
+	a.audit(ctx, adminID, "broadcast", 0, fmt.Sprintf("sent=%d failed=%d skipped=%d", sent, len(failures), skipped), AuditSuccess)
+	a.logger.Info("广播完成",
+		zap.Int64("AdminID", adminID),
+		zap.Int("Sent", sent),
+		zap.Int("Failed", len(failures)),
+		zap.Int("Skipped", skipped),
+	)
+
+	var sb strings.Builder
+	sb.WriteString(a.t(ctx, "broadcast.summary", sent, len(failures), skipped))
+	if len(failures) > 0 {
+		sb.WriteString(a.t(ctx, "broadcast.failures"))
+		for i, f := range failures {
+			if i >= broadcastMaxFailures {
+				sb.WriteString(a.t(ctx, "broadcast.more_failures", len(failures)-i))
+				break
+			}
+			fmt.Fprintf(&sb, "%d: %s\n", f.UserID, f.Err)
+		}
+	}
+
+	if _, err := a.sendMessageTo(ctx, bt, chatID, sb.String(), false); err != nil {
+		a.logger.Error("发送广播汇总失败", zap.Error(err))
+	}
+}
@@ -0,0 +1,175 @@
+package atri
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// 回调数据的种类
+const (
+	callbackAccess    = "access"    // access:<approve|deny>:<申请ID>
+	callbackCancel    = "cancel"    // cancel
+	callbackMemoryRm  = "memrm"     // memrm:<记忆ID>
+	callbackUserRm    = "userrm"    // userrm:<用户ID>[:purge]
+	callbackMemPage   = "mempage"   // mempage:<页码>
+	callbackUserPage  = "userpage"  // userpage:<页码>
+	callbackRegen     = "regen"     // regen:<轮ID>
+	callbackForgetMe  = "forgetme"  // forgetme
+	callbackBroadcast = "broadcast" // broadcast, 广播内容即按钮所在消息的内容
+)
+
+// callbackData 是按钮上携带的回调数据, 序列化为 kind:arg1:arg2 的形式
+type callbackData struct {
+	Kind string
+	Args []string
+}
+
+func newCallbackData(kind string, args ...any) callbackData {
+	data := callbackData{Kind: kind}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			data.Args = append(data.Args, v)
+		case int:
+			data.Args = append(data.Args, strconv.Itoa(v))
+		case int64:
+			data.Args = append(data.Args, strconv.FormatInt(v, 10))
+		case uint:
+			data.Args = append(data.Args, strconv.FormatUint(uint64(v), 10))
+		}
+	}
+	return data
+}
+
+func parseCallbackData(s string) callbackData {
+	parts := strings.Split(s, ":")
+	return callbackData{Kind: parts[0], Args: parts[1:]}
+}
+
+func (c callbackData) String() string {
+	return strings.Join(append([]string{c.Kind}, c.Args...), ":")
+}
+
+// button 创建一个携带该回调数据的按钮
+func (c callbackData) button(text string) models.InlineKeyboardButton {
+	return models.InlineKeyboardButton{Text: text, CallbackData: c.String()}
+}
+
+func (c callbackData) arg(i int) string {
+	if i >= len(c.Args) {
+		return ""
+	}
+	return c.Args[i]
+}
+
+func (c callbackData) intArg(i int) (int64, error) {
+	return strconv.ParseInt(c.arg(i), 10, 64)
+}
+
+func (c callbackData) uintArg(i int) (uint, error) {
+	n, err := strconv.ParseUint(c.arg(i), 10, 64)
+	return uint(n), err
+}
+
+// confirmKeyboard 构建确认/取消按钮
+func (a *Atri) confirmKeyboard(ctx context.Context, confirm callbackData) [][]models.InlineKeyboardButton {
+	return [][]models.InlineKeyboardButton{{
+		confirm.button(a.t(ctx, "confirm")),
+		newCallbackData(callbackCancel).button(a.t(ctx, "cancel")),
+	}}
+}
+
+// pageKeyboard 构建翻页按钮, 只有一页时返回nil
+func (a *Atri) pageKeyboard(ctx context.Context, kind string, page int, totalPages int) [][]models.InlineKeyboardButton {
+	row := []models.InlineKeyboardButton{}
+	if page > 0 {
+		row = append(row, newCallbackData(kind, page-1).button(a.t(ctx, "page.prev")))
+	}
+	if page < totalPages-1 {
+		row = append(row, newCallbackData(kind, page+1).button(a.t(ctx, "page.next")))
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	return [][]models.InlineKeyboardButton{row}
+}
+
+// handlerForCallbackQuery 是所有回调查询的入口
+func (a *Atri) handlerForCallbackQuery(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery) {
+	data := parseCallbackData(query.Data)
+	ctx = withLanguage(ctx, a.resolveLanguage(ctx, query.From.ID, query.From.LanguageCode))
+
+	a.logger.Info("收到回调",
+		zap.Int64("UserID", query.From.ID),
+		zap.String("Data", query.Data),
+	)
+
+	answer, err := a.executeCallback(ctx, bt, query, data)
+	if err != nil {
+		a.logger.Error("处理回调失败", zap.String("Data", query.Data), zap.Error(err))
+		a.metrics.errors.WithLabelValues(errorType(err)).Inc()
+		answer = a.t(ctx, "callback_error")
+	}
+
+	if err := a.answerCallbackQuery(ctx, bt, query.ID, answer); err != nil {
+		a.logger.Error("应答回调失败", zap.Error(err))
+	}
+}
+
+// executeCallback 分发回调, 返回给用户的简短提示
+func (a *Atri) executeCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	handlers := map[string]callbackHandlerFunc{
+		callbackAccess:    a.handleAccessCallback,
+		callbackCancel:    a.handleCancelCallback,
+		callbackMemoryRm:  a.handleMemoryRemoveCallback,
+		callbackUserRm:    a.handleUserRemoveCallback,
+		callbackMemPage:   a.handleMemoryPageCallback,
+		callbackUserPage:  a.handleUserPageCallback,
+		callbackRegen:     a.handleRegenerateCallback,
+		callbackForgetMe:  a.handleForgetMeCallback,
+		callbackBroadcast: a.handleBroadcastCallback,
+	}
+
+	handler, ok := handlers[data.Kind]
+	if !ok {
+		return a.t(ctx, "invalid_action"), nil
+	}
+
+	inBuck, err := a.hasUser(ctx, query.From.ID)
+	if err != nil {
+		return "", err
+	}
+	if !inBuck {
+		a.auditAccessDenied(ctx, query.From.ID, "callback:"+data.Kind)
+		return a.t(ctx, "not_in_allowlist"), nil
+	}
+
+	ban, err := a.activeBan(ctx, query.From.ID)
+	if err != nil {
+		return "", err
+	}
+	if ban != nil {
+		if ok, _ := a.bannedLimiter.allow(query.From.ID, 1, accessDeniedAuditWait); ok {
+			a.audit(ctx, query.From.ID, "access.banned", query.From.ID, "callback:"+data.Kind, AuditDenied)
+		}
+		return a.t(ctx, "banned"), nil
+	}
+
+	// 按钮所在的消息可能已经无法访问
+	if query.Message.Message == nil {
+		return a.t(ctx, "message_expired"), nil
+	}
+
+	return handler(ctx, bt, query, data)
+}
+
+func (a *Atri) handleCancelCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, _ callbackData) (string, error) {
+	msg := query.Message.Message
+	_, err := a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, a.t(ctx, "cancelled"), nil)
+	return a.t(ctx, "cancelled.short"), err
+}
@@ -2,23 +2,49 @@ package atri
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"github.com/openai/openai-go/v3"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
-// handleAiChat 处理 AI 聊天逻辑
-func (a *Atri) handleAiChat(ctx context.Context, bt *bot.Bot, userID int64, username string, chatID int64, chatText string) error {
+// handleAiChat 处理 AI 聊天逻辑, messageID是触发本轮对话的用户消息ID.
+// replaceRoundID不为0时重新回答该轮(必须是最新的一轮), 旧的一轮在新的一轮保存成功后才删除
+func (a *Atri) handleAiChat(ctx context.Context, bt *bot.Bot, userID int64, username string, chatID int64, chatType models.ChatType, chatText string, messageID int, replaceRoundID uint) (err error) {
+	ctx, span := a.startSpan(ctx, "atri.chat", attrUserID.Int64(userID), attrChatID.Int64(chatID))
+	defer func() { endSpan(span, err) }()
+
+	// 同一用户的对话依次进行, 不影响其他用户. 先加锁再获取会话, 会话被重置后重新加载时能读到上一轮对话
+	lock := a.chatLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	session := a.getSessionOrInit(ctx, userID)
 
-	a.userSessionLock.Lock()
-	defer a.userSessionLock.Unlock()
+	session.lock.Lock()
+	histories := session.histories
+	session.lock.Unlock()
+	if replaceRoundID != 0 {
+		last, err := a.store.GetLastRound(ctx, userID)
+		if errors.Is(err, ErrNotFound) || (err == nil && last.ID != replaceRoundID) {
+			return errRoundNotLatest
+		}
+		if err != nil {
+			return err
+		}
+
+		// 被替换的一轮不作为上下文
+		if len(histories) > 0 {
+			histories = histories[:len(histories)-1]
+		}
+	}
 
-	systemPromptMessage, err := a.buildSystemPromptMessage(ctx, a.config.SystemPrompt, userID, username)
+	systemPromptMessage, err := a.buildSystemPromptMessage(ctx, userID, username, chatType)
 	if err != nil {
 		return err
 	}
@@ -26,27 +52,50 @@ func (a *Atri) handleAiChat(ctx context.Context, bt *bot.Bot, userID int64, user
 	thisRound := roundHistory{}
 	thisRound = append(
 		thisRound,
-		a.buildTimeSystemMessage(),
+		a.buildTimeSystemMessage(a.userLocation(ctx, userID)),
 		a.buildUserMessage(chatText),
 	)
 
+	tools := a.getTools(ctx, userID)
+
 	stopTyping := a.startTypingLoop(ctx, bt, chatID)
 	defer stopTyping()
 
+	var usage openai.CompletionUsage
+	// 无论这一轮是否成功都记录已经消耗的用量, 避免反复失败的对话绕过额度
+	defer func() {
+		if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+			return
+		}
+		if err := a.recordUsage(ctx, userID, a.config.Model, usage); err != nil {
+			a.logger.Error("记录用量失败", zap.Error(err))
+		}
+	}()
+	messageUsage := map[int]openai.CompletionUsage{}
+	lastMessageID := 0
+
 	// 循环处理，直到没有工具调用
 	for {
 		allHistories := []openai.ChatCompletionMessageParamUnion{}
-		for _, round := range session.histories {
+		for _, round := range histories {
 			allHistories = append(allHistories, round...)
 		}
 		allHistories = append(allHistories, thisRound...)
 
-		fullContent, finishedToolCalls, err := a.processStreamResponse(ctx, bt, chatID, allHistories, systemPromptMessage)
+		result, err := a.processStreamResponse(ctx, bt, chatID, allHistories, systemPromptMessage, tools)
+		usage.PromptTokens += result.usage.PromptTokens
+		usage.CompletionTokens += result.usage.CompletionTokens
+		usage.TotalTokens += result.usage.TotalTokens
 		if err != nil {
 			return err
 		}
+		if result.lastMessageID != 0 {
+			lastMessageID = result.lastMessageID
+		}
 
-		assistantMsg := openai.AssistantMessage(fullContent)
+		finishedToolCalls := result.toolCalls
+		assistantMsg := openai.AssistantMessage(result.content)
+		messageUsage[len(thisRound)] = result.usage
 
 		// 如果有工具调用
 		if len(finishedToolCalls) > 0 {
@@ -81,18 +130,32 @@ func (a *Atri) handleAiChat(ctx context.Context, bt *bot.Bot, userID int64, user
 	}
 
 	// 保存历史
-	err = a.writeHistoryToDB(ctx, thisRound, userID)
+	roundID, err := a.writeHistoryToDB(ctx, thisRound, messageUsage, userID, messageID, usage)
 	if err != nil {
 		return err
 	}
 
-	session.histories = append(session.histories, thisRound)
-	session.histories = a.trimHistoryToMaxRounds(session.histories)
+	if replaceRoundID != 0 {
+		err := a.store.DeleteRound(ctx, userID, replaceRoundID)
+		if err != nil {
+			a.logger.Error("删除被替换的一轮对话失败", zap.Int64("UserID", userID), zap.Uint("RoundID", replaceRoundID), zap.Error(err))
+		}
+	}
+
+	if lastMessageID != 0 {
+		a.attachRegenerateButton(ctx, bt, chatID, lastMessageID, roundID)
+	}
+
+	session.lock.Lock()
+	session.histories = a.trimHistoryToMaxRounds(append(histories, thisRound))
+	totalRounds := len(session.histories)
+	session.lock.Unlock()
 
 	a.logger.Info(
 		"会话完成",
 		zap.Int64("UserID", userID),
-		zap.Int("TotalRounds", len(session.histories)),
+		zap.Int("TotalRounds", totalRounds),
+		zap.Int64("TotalTokens", usage.TotalTokens),
 	)
 
 	return nil
@@ -140,27 +203,55 @@ func (a *Atri) startTypingLoop(ctx context.Context, bt *bot.Bot, chatID int64) f
 	}
 }
 
-// processStreamResponse 处理流式响应，返回完整内容和工具调用
+// streamResult 是一次流式响应的结果
+type streamResult struct {
+	content       string
+	toolCalls     []openai.FinishedChatCompletionToolCall
+	usage         openai.CompletionUsage
+	lastMessageID int // 最后一条发送给用户的消息ID, 没有发送时为0
+}
+
+// processStreamResponse 处理流式响应，返回完整内容、工具调用和Token用量. 出错时也返回已经消耗的用量
 func (a *Atri) processStreamResponse(
 	ctx context.Context,
 	bt *bot.Bot,
 	chatID int64,
 	histories []openai.ChatCompletionMessageParamUnion,
 	systemPrompt openai.ChatCompletionMessageParamUnion,
-) (string, []openai.FinishedChatCompletionToolCall, error) {
+	tools []openai.ChatCompletionToolUnionParam,
+) (result streamResult, err error) {
+	ctx, span := a.startSpan(ctx, "atri.llm.stream",
+		attrChatID.Int64(chatID),
+		attribute.String("llm.model", a.config.Model),
+		attribute.Int("llm.messages", len(histories)+1),
+	)
+	defer func() {
+		span.SetAttributes(
+			attribute.Int64("llm.prompt_tokens", result.usage.PromptTokens),
+			attribute.Int64("llm.completion_tokens", result.usage.CompletionTokens),
+			attribute.Int("llm.tool_calls", len(result.toolCalls)),
+		)
+		endSpan(span, err)
+	}()
 
+	lastMessageID := 0
 	cached := []rune{}
 	sendAndResetCached := func(theCached []rune) error {
 		if len(theCached) == 0 {
 			return nil
 		}
 		msg := string(theCached)
-		_, err := a.sendMessageTo(ctx, bt, chatID, msg, false)
-		return err
+		sent, err := a.sendMessageTo(ctx, bt, chatID, msg, false)
+		if err != nil {
+			return err
+		}
+		lastMessageID = sent.ID
+		return nil
 	}
 
 	waitingForFirstToken := true
 	a.logger.Debug("调用API")
+	start := time.Now()
 	acc := &openai.ChatCompletionAccumulator{}
 	var fullContent strings.Builder
 	var finishedToolCalls []openai.FinishedChatCompletionToolCall
@@ -168,7 +259,10 @@ func (a *Atri) processStreamResponse(
 	stream := a.openaiClient.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
 		Messages: append([]openai.ChatCompletionMessageParamUnion{systemPrompt}, histories...),
 		Model:    a.config.Model,
-		Tools:    a.getTools(),
+		Tools:    tools,
+		StreamOptions: openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		},
 	})
 
 	for stream.Next() {
@@ -182,6 +276,13 @@ func (a *Atri) processStreamResponse(
 		deltaContent := chunk.Choices[0].Delta.Content
 		fullContent.WriteString(deltaContent)
 
+		if waitingForFirstToken && (deltaContent != "" || len(chunk.Choices[0].Delta.ToolCalls) > 0) {
+			waitingForFirstToken = false
+			a.metrics.llmFirstToken.WithLabelValues(a.config.Model).Observe(sinceSeconds(start))
+			span.AddEvent("first_token")
+			a.logger.Debug("Received the first token", zap.String("Delta", deltaContent))
+		}
+
 		if toolCall, ok := acc.JustFinishedToolCall(); ok {
 			finishedToolCalls = append(finishedToolCalls, toolCall)
 		}
@@ -190,11 +291,6 @@ func (a *Atri) processStreamResponse(
 			continue
 		}
 
-		if waitingForFirstToken {
-			waitingForFirstToken = false
-			a.logger.Debug("Received the first token", zap.String("Delta", deltaContent))
-		}
-
 		for _, char := range deltaContent {
 			cached = append(cached, char)
 			lCached := len(cached)
@@ -203,7 +299,7 @@ func (a *Atri) processStreamResponse(
 			if lCached >= 2 && cached[lCached-1] == '\n' && cached[lCached-2] == '\n' {
 				err := sendAndResetCached(cached)
 				if err != nil {
-					return "", nil, err
+					return streamResult{usage: acc.Usage}, err
 				}
 				cached = []rune{}
 			}
@@ -211,15 +307,97 @@ func (a *Atri) processStreamResponse(
 	}
 
 	if err := stream.Err(); err != nil {
-		return "", nil, err
+		return streamResult{usage: acc.Usage}, err
 	}
 
+	a.metrics.llmDuration.WithLabelValues(a.config.Model).Observe(sinceSeconds(start))
+	a.metrics.observeUsage(a.config.Model, acc.Usage)
+
 	// 发送剩余的内容
 	if len(cached) > 0 {
 		if err := sendAndResetCached(cached); err != nil {
-			return "", nil, err
+			return streamResult{usage: acc.Usage}, err
 		}
 	}
 
-	return fullContent.String(), finishedToolCalls, nil
+	return streamResult{
+		content:       fullContent.String(),
+		toolCalls:     finishedToolCalls,
+		usage:         acc.Usage,
+		lastMessageID: lastMessageID,
+	}, nil
+}
+
+// attachRegenerateButton 为回答的最后一条消息添加重新生成按钮
+func (a *Atri) attachRegenerateButton(ctx context.Context, bt *bot.Bot, chatID int64, messageID int, roundID uint) {
+	keyboard := [][]models.InlineKeyboardButton{{
+		newCallbackData(callbackRegen, roundID).button(a.t(ctx, "regen.button")),
+	}}
+
+	err := a.editMessageKeyboard(ctx, bt, chatID, messageID, keyboard)
+	if err != nil {
+		a.logger.Error("添加重新生成按钮失败", zap.Error(err))
+	}
+}
+
+// latestRoundText 返回最新的一轮对话中用户发送的内容和对应的消息ID, 要求roundID必须是最新的一轮
+func (a *Atri) latestRoundText(ctx context.Context, userID int64, roundID uint) (string, int, error) {
+	last, err := a.store.GetLastRound(ctx, userID)
+	if err != nil {
+		return "", 0, err
+	}
+	if last.ID != roundID {
+		return "", 0, errRoundNotLatest
+	}
+
+	round, err := last.history()
+	if err != nil {
+		return "", 0, err
+	}
+	return userTextOfRound(round), last.MessageID, nil
+}
+
+// handleRegenerateCallback 重新生成最新的一轮对话的回答
+func (a *Atri) handleRegenerateCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	userID := query.From.ID
+	msg := query.Message.Message
+
+	roundID, err := data.uintArg(0)
+	if err != nil {
+		return a.t(ctx, "invalid_action"), nil
+	}
+
+	limitMsg, err := a.checkQuota(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if limitMsg != "" {
+		return limitMsg, nil
+	}
+
+	chatText, messageID, err := a.latestRoundText(ctx, userID, roundID)
+	if errors.Is(err, errRoundNotLatest) || errors.Is(err, ErrNotFound) {
+		return a.t(ctx, "regen.not_latest"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// 移除旧回答上的按钮
+	if err := a.editMessageKeyboard(ctx, bt, msg.Chat.ID, msg.ID, [][]models.InlineKeyboardButton{}); err != nil {
+		a.logger.Error("移除重新生成按钮失败", zap.Error(err))
+	}
+
+	go func() {
+		err := a.handleAiChat(ctx, bt, userID, query.From.Username, msg.Chat.ID, msg.Chat.Type, chatText, messageID, roundID)
+		if errors.Is(err, errRoundNotLatest) {
+			a.sendMessageTo(ctx, bt, msg.Chat.ID, a.t(ctx, "regen.not_latest"), false)
+			return
+		}
+		if err != nil {
+			a.sendError(ctx, bt, msg.Chat.ID, err)
+		}
+	}()
+
+	return a.t(ctx, "regen.started"), nil
 }
@@ -3,67 +3,90 @@ package atri
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 )
 
+// listPageSize 是列表类命令每页显示的条数
+const listPageSize = 10
+
+// pageCount 计算总页数, 至少为1页
+func pageCount(total int64) int {
+	return max(1, int((total+listPageSize-1)/listPageSize))
+}
+
 // executeCommand 执行命令
 func (a *Atri) executeCommand(ctx context.Context, bt *bot.Bot, command string, chatID int64, userID int64, args []string) error {
 	handlers := map[string]commandHandlerFunc{
-		"help":   a.handleHelp,
-		"info":   a.handleInfo,
-		"memory": a.handleMemory,
-		"user":   a.handleUserCommand,
+		"help":      a.handleHelp,
+		"info":      a.handleInfo,
+		"memory":    a.handleMemory,
+		"user":      a.handleUserCommand,
+		"usage":     a.handleUsage,
+		"quota":     a.handleQuota,
+		"invite":    a.handleInvite,
+		"export":    a.handleExport,
+		"import":    a.handleImport,
+		"search":    a.handleSearch,
+		"forgetme":  a.handleForgetMe,
+		"audit":     a.handleAudit,
+		"broadcast": a.handleBroadcast,
+		"remind":    a.handleRemind,
+		"schedule":  a.handleSchedule,
+		"settings":  a.handleSettings,
 	}
 
 	if handler, ok := handlers[command]; ok {
+		a.metrics.commands.WithLabelValues(command).Inc()
 		return handler(ctx, bt, chatID, userID, args)
 	}
 
 	// 默认处理未知命令
-	_, err := a.sendMessageTo(ctx, bt, chatID, ">_< 不理解你在说啥喵", false)
+	a.metrics.commands.WithLabelValues("unknown").Inc()
+	_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "unknown_command"), false)
 	return err
 }
 
 func (a *Atri) handleHelp(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, _ []string) error {
-	help := `下面的指令是支持的喵~
-/help 显示这条命令
-/info 查看对话信息
-/memory ls 列出所有memory
-/memory rm <ID> 删除memory
-/user ls 列出所有用户
-/user add <ID> [admin] 添加用户
-/user rm <ID> 删除用户
-/user setadmin <ID> <true|false> 设置管理员`
+	help := a.t(ctx, "help")
 	_, err := a.sendMessageTo(ctx, bt, chatID, help, false)
 	return err
 }
 
 func (a *Atri) handleInfo(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
-	msg := `信息
-
-当前内存中的轮数:%d
-配置的最大轮数:%s
-数据库中的总消息数量:%d
-已经存储的记忆数量:%d
-模型:%s
-`
+	msg := a.t(ctx, "info")
 	session := a.getSessionOrInit(ctx, userID)
+	session.lock.Lock()
 	roundsInMemory := len(session.histories)
+	session.lock.Unlock()
+
+	totalMessagesInDB, err := a.store.CountRounds(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	memories, err := a.store.ListMemories(ctx, userID)
+	if err != nil {
+		return err
+	}
 
-	totalMessagesInDB, err := a.countHistoryInDB(ctx, userID)
+	now := time.Now()
+	todayUsage, err := a.summarizeUsageSince(ctx, userID, now)
 	if err != nil {
 		return err
 	}
 
-	memories, err := a.loadMemories(ctx, userID)
+	monthUsage, err := a.summarizeUsageSince(ctx, userID, now.AddDate(0, 0, 1-now.Day()))
 	if err != nil {
 		return err
 	}
 
-	maxRoundsStr := "无限制"
+	maxRoundsStr := a.t(ctx, "info.unlimited")
 	if a.config.MaxRounds > 0 {
 		maxRoundsStr = fmt.Sprintf("%d", a.config.MaxRounds)
 	}
@@ -79,6 +102,8 @@ func (a *Atri) handleInfo(ctx context.Context, bt *bot.Bot, chatID int64, userID
 			totalMessagesInDB,
 			len(memories),
 			a.config.Model,
+			a.describeUsage(ctx, todayUsage),
+			a.describeUsage(ctx, monthUsage),
 		),
 		false,
 	)
@@ -96,64 +121,111 @@ func (a *Atri) handleMemory(ctx context.Context, bt *bot.Bot, chatID int64, user
 	case "rm", "remove":
 		return a.handleMemoryRemove(ctx, bt, chatID, userID, args[1:])
 	default:
-		_, err := a.sendMessageTo(ctx, bt, chatID, "未知子命令喵~ 请使用 ls (list) 或 rm (remove)", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "memory.unknown_subcommand"), false)
 		return err
 	}
 }
 
 func (a *Atri) handleMemoryList(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
-	memories, err := a.loadMemories(ctx, userID)
+	msg, keyboard, err := a.renderMemoryPage(ctx, userID, 0)
 	if err != nil {
 		return err
 	}
 
+	_, err = a.sendMessageWithKeyboard(ctx, bt, chatID, msg, keyboard)
+	return err
+}
+
+// renderMemoryPage 渲染记忆列表的某一页
+func (a *Atri) renderMemoryPage(ctx context.Context, userID int64, page int) (string, [][]models.InlineKeyboardButton, error) {
+	total, err := a.store.CountMemories(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	totalPages := pageCount(total)
+	page = min(max(page, 0), totalPages-1)
+
+	memories, err := a.store.ListMemoriesPage(ctx, userID, page*listPageSize, listPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
 	var sb strings.Builder
 	for _, m := range memories {
 		fmt.Fprintf(&sb, "ID: %d - %s\n", m.ID, m.Memory)
 	}
 
 	if sb.Len() == 0 {
-		sb.WriteString("没有记忆喵~")
+		sb.WriteString(a.t(ctx, "memory.empty"))
 	}
 
-	msg := `所有的记忆
+	return a.t(ctx, "memory.page", page+1, totalPages, sb.String()), a.pageKeyboard(ctx, callbackMemPage, page, totalPages), nil
+}
+
+func (a *Atri) handleMemoryPageCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	page, err := data.intArg(0)
+	if err != nil {
+		return a.t(ctx, "invalid_page"), nil
+	}
 
-%s
-如果要删除某条记忆, 请输入/memory rm <ID>`
+	text, keyboard, err := a.renderMemoryPage(ctx, query.From.ID, int(page))
+	if err != nil {
+		return "", err
+	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, fmt.Sprintf(msg, sb.String()), false)
-	return err
+	msg := query.Message.Message
+	_, err = a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, text, keyboard)
+	return "", err
 }
 
 func (a *Atri) handleMemoryRemove(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
 	if len(args) < 1 {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "请输入要删除的记忆ID喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "memory.rm.missing_id"), false)
 		return err
 	}
 
 	idStr := args[0]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "ID必须是数字喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "id_not_number"), false)
 		return err
 	}
 
-	err = a.deleteMemory(ctx, userID, uint(id))
+	mem, err := a.store.GetMemory(ctx, userID, uint(id))
 	if err != nil {
-		_, sendErr := a.sendMessageTo(ctx, bt, chatID, "无法删除记忆喵~ 请确认ID是否正确且属于你自己", false)
+		_, sendErr := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "memory.rm.failed"), false)
 		if sendErr != nil {
 			return sendErr
 		}
 		return nil
 	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, "删除成功喵!", false)
+	confirm := newCallbackData(callbackMemoryRm, mem.ID)
+	_, err = a.sendMessageWithKeyboard(ctx, bt, chatID, a.t(ctx, "memory.rm.confirm", mem.ID, mem.Memory), a.confirmKeyboard(ctx, confirm))
 	return err
 }
 
+func (a *Atri) handleMemoryRemoveCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	id, err := data.uintArg(0)
+	if err != nil {
+		return a.t(ctx, "invalid_id"), nil
+	}
+
+	msg := query.Message.Message
+	err = a.store.DeleteMemory(ctx, query.From.ID, id)
+	a.audit(ctx, query.From.ID, "memory.remove", query.From.ID, strconv.FormatUint(uint64(id), 10), auditOutcome(err))
+	if err != nil {
+		_, err := a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, a.t(ctx, "memory.rm.failed"), nil)
+		return "", err
+	}
+
+	_, err = a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, a.t(ctx, "deleted"), nil)
+	return "", err
+}
+
 func (a *Atri) handleUserCommand(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
-	if !a.isAdmin(ctx, userID) {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "只有管理员可以执行该命令喵~", false)
+	if !a.requirePermission(ctx, userID, PermManageUsers, "user") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
 		return err
 	}
 
@@ -170,49 +242,93 @@ func (a *Atri) handleUserCommand(ctx context.Context, bt *bot.Bot, chatID int64,
 		return a.handleUserRemove(ctx, bt, chatID, userID, args[1:])
 	case "setadmin":
 		return a.handleUserSetAdmin(ctx, bt, chatID, userID, args[1:])
+	case "role":
+		return a.handleUserRole(ctx, bt, chatID, userID, args[1:])
+	case "ban":
+		return a.handleUserBan(ctx, bt, chatID, userID, args[1:])
+	case "unban":
+		return a.handleUserUnban(ctx, bt, chatID, userID, args[1:])
 	default:
-		_, err := a.sendMessageTo(ctx, bt, chatID, "未知子命令喵~ 请使用 ls/add/rm/setadmin", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.unknown_subcommand"), false)
 		return err
 	}
 }
 
 func (a *Atri) handleUserList(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, _ []string) error {
-	users, err := a.loadUsers(ctx)
+	msg, keyboard, err := a.renderUserPage(ctx, 0)
 	if err != nil {
 		return err
 	}
 
+	_, err = a.sendMessageWithKeyboard(ctx, bt, chatID, msg, keyboard)
+	return err
+}
+
+// renderUserPage 渲染用户列表的某一页
+func (a *Atri) renderUserPage(ctx context.Context, page int) (string, [][]models.InlineKeyboardButton, error) {
+	total, err := a.store.CountUsers(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	totalPages := pageCount(total)
+	page = min(max(page, 0), totalPages-1)
+
+	users, err := a.store.ListUsersPage(ctx, page*listPageSize, listPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
 	var sb strings.Builder
 	for _, u := range users {
-		role := "User"
-		if u.IsAdmin {
-			role = "Admin"
-		}
-		fmt.Fprintf(&sb, "ID: %d - %s\n", u.UserID, role)
+		fmt.Fprintf(&sb, "ID: %d - %s\n", u.UserID, u.effectiveRole())
 	}
 
 	if sb.Len() == 0 {
-		sb.WriteString("没有任何用户喵~")
+		sb.WriteString(a.t(ctx, "user.empty"))
 	}
 
-	msg := `所有的用户
+	return a.t(ctx, "user.page", page+1, totalPages, sb.String()), a.pageKeyboard(ctx, callbackUserPage, page, totalPages), nil
+}
 
-%s`
+func (a *Atri) handleUserPageCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	if !a.requirePermission(ctx, query.From.ID, PermManageUsers, "user.list") {
+		return a.t(ctx, "no_permission_action"), nil
+	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, fmt.Sprintf(msg, sb.String()), false)
-	return err
+	page, err := data.intArg(0)
+	if err != nil {
+		return a.t(ctx, "invalid_page"), nil
+	}
+
+	text, keyboard, err := a.renderUserPage(ctx, int(page))
+	if err != nil {
+		return "", err
+	}
+
+	msg := query.Message.Message
+	_, err = a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, text, keyboard)
+	return "", err
 }
 
-func (a *Atri) handleUserAdd(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, args []string) error {
+func (a *Atri) handleUserAdd(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
 	if len(args) < 1 {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "请输入要添加的用户ID喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.add.missing_id"), false)
 		return err
 	}
 
 	idStr := args[0]
 	targetID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "用户ID必须是数字喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
+		return err
+	}
+
+	ban, err := a.activeBan(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	if ban != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.add.banned", a.banDescription(ctx, ban)), false)
 		return err
 	}
 
@@ -220,48 +336,95 @@ func (a *Atri) handleUserAdd(ctx context.Context, bt *bot.Bot, chatID int64, _ i
 	if len(args) >= 2 && strings.ToLower(args[1]) == "admin" {
 		isAdmin = true
 	}
+	if isAdmin && !a.canGrantRole(ctx, userID, RoleAdmin) {
+		a.audit(ctx, userID, "user.add", targetID, strings.Join(args, " "), AuditDenied)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.above_self"), false)
+		return err
+	}
 
-	err = a.createUser(ctx, targetID, isAdmin)
+	err = a.store.CreateUser(ctx, targetID, isAdmin)
+	a.audit(ctx, userID, "user.add", targetID, strings.Join(args, " "), auditOutcome(err))
 	if err != nil {
 		return err
 	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, "添加用户成功喵!", false)
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.add.success"), false)
 	return err
 }
 
 func (a *Atri) handleUserRemove(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, args []string) error {
+	purge := slices.Contains(args, "--purge")
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == "--purge" })
+
 	if len(args) < 1 {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "请输入要删除的用户ID喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.rm.missing_id"), false)
 		return err
 	}
 
 	idStr := args[0]
 	targetID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "用户ID必须是数字喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
 		return err
 	}
 
-	err = a.deleteUser(ctx, targetID)
-	if err != nil {
-		return err
+	confirm := newCallbackData(callbackUserRm, targetID)
+	text := a.t(ctx, "user.rm.confirm", targetID)
+	if purge {
+		confirm = newCallbackData(callbackUserRm, targetID, "purge")
+		text = a.t(ctx, "user.rm.confirm_purge", targetID)
 	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, "删除用户成功喵!", false)
+	_, err = a.sendMessageWithKeyboard(ctx, bt, chatID, text, a.confirmKeyboard(ctx, confirm))
 	return err
 }
 
+func (a *Atri) handleUserRemoveCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, data callbackData) (string, error) {
+	if !a.requirePermission(ctx, query.From.ID, PermManageUsers, "user.remove") {
+		return a.t(ctx, "no_permission_action"), nil
+	}
+
+	targetID, err := data.intArg(0)
+	if err != nil {
+		return a.t(ctx, "invalid_id"), nil
+	}
+
+	if !a.canManageUser(ctx, query.From.ID, targetID) {
+		a.audit(ctx, query.From.ID, "user.remove", targetID, "", AuditDenied)
+		return a.t(ctx, "role.above_self"), nil
+	}
+
+	err = a.store.DeleteUser(ctx, targetID)
+	a.audit(ctx, query.From.ID, "user.remove", targetID, "", auditOutcome(err))
+	if err != nil {
+		return "", err
+	}
+
+	text := a.t(ctx, "user.rm.success")
+	if data.arg(1) == "purge" {
+		err := a.forgetUser(ctx, targetID)
+		a.audit(ctx, query.From.ID, "user.purge", targetID, "", auditOutcome(err))
+		if err != nil {
+			return "", err
+		}
+		text = a.t(ctx, "user.rm.success_purge")
+	}
+
+	msg := query.Message.Message
+	_, err = a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, text, nil)
+	return "", err
+}
+
 func (a *Atri) handleUserSetAdmin(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
 	if len(args) < 2 {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "用法: /user setadmin <ID> <true|false>", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.setadmin.usage"), false)
 		return err
 	}
 
 	idStr := args[0]
 	targetID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "用户ID必须是数字喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
 		return err
 	}
 
@@ -269,15 +432,22 @@ func (a *Atri) handleUserSetAdmin(ctx context.Context, bt *bot.Bot, chatID int64
 	isAdmin := flagStr == "true" || flagStr == "1" || flagStr == "yes"
 
 	if targetID == userID && !isAdmin {
-		_, err := a.sendMessageTo(ctx, bt, chatID, "不可以把自己从管理员降级为普通用户喵~", false)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.setadmin.self"), false)
+		return err
+	}
+
+	if !a.canGrantRole(ctx, userID, RoleAdmin) || !a.canManageUser(ctx, userID, targetID) {
+		a.audit(ctx, userID, "user.setadmin", targetID, strconv.FormatBool(isAdmin), AuditDenied)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.above_self"), false)
 		return err
 	}
 
-	err = a.updateUserAdmin(ctx, targetID, isAdmin)
+	err = a.store.UpdateUserAdmin(ctx, targetID, isAdmin)
+	a.audit(ctx, userID, "user.setadmin", targetID, strconv.FormatBool(isAdmin), auditOutcome(err))
 	if err != nil {
 		return err
 	}
 
-	_, err = a.sendMessageTo(ctx, bt, chatID, "更新管理员状态成功喵!", false)
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user.setadmin.success"), false)
 	return err
 }
@@ -0,0 +1,121 @@
+package atri
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix 是加密字段的前缀, 格式为 enc:v1:<密钥ID>:<base64(nonce+密文)>
+const encryptedPrefix = "enc:v1:"
+
+// errUnknownKey 表示密文使用的密钥不在密钥列表中
+var errUnknownKey = errors.New("找不到解密所需的密钥")
+
+// keyring 保存用于字段加密的AES-GCM密钥, 第一个密钥用于加密, 所有密钥都可以用于解密
+type keyring struct {
+	primaryID string
+	aeads     map[string]cipher.AEAD
+}
+
+// newKeyring 根据密钥列表创建keyring, 每个密钥必须是16/24/32字节
+func newKeyring(keys [][]byte) (*keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("至少需要一个密钥")
+	}
+
+	k := &keyring{aeads: map[string]cipher.AEAD{}}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个密钥无效: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		id := keyID(key)
+		if i == 0 {
+			k.primaryID = id
+		}
+		k.aeads[id] = aead
+	}
+
+	return k, nil
+}
+
+// keyID 返回密钥的指纹, 用于在密文中标识所使用的密钥
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// encrypt 使用主密钥加密, 空字符串保持不变
+func (k *keyring) encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	aead := k.aeads[k.primaryID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + k.primaryID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// primaryPrefix 返回使用主密钥加密的字段的前缀
+func (k *keyring) primaryPrefix() string {
+	return encryptedPrefix + k.primaryID + ":"
+}
+
+// rewrap 使用主密钥重新加密字段: 明文会被加密, 使用其他密钥加密的密文会被解密后重新加密
+func (k *keyring) rewrap(value string) (string, error) {
+	plaintext, err := k.decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return k.encrypt(plaintext)
+}
+
+// decrypt 解密字段, 没有加密前缀的内容视为启用加密之前写入的明文, 原样返回
+func (k *keyring) decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("密文格式不正确")
+	}
+
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("密文长度不正确")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
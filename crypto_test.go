@@ -0,0 +1,167 @@
+package atri
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyA = bytes.Repeat([]byte{'a'}, 32)
+	testKeyB = bytes.Repeat([]byte{'b'}, 16)
+)
+
+func mustKeyring(t *testing.T, keys ...[]byte) *keyring {
+	t.Helper()
+	k, err := newKeyring(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	k := mustKeyring(t, testKeyA)
+
+	for _, plaintext := range []string{"", "hello", "喵~ 你好\n世界"} {
+		sealed, err := k.encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && (sealed == plaintext || !strings.HasPrefix(sealed, k.primaryPrefix())) {
+			t.Fatalf("encrypt(%q) = %q, want ciphertext with prefix %q", plaintext, sealed, k.primaryPrefix())
+		}
+
+		opened, err := k.decrypt(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened != plaintext {
+			t.Fatalf("decrypt(encrypt(%q)) = %q", plaintext, opened)
+		}
+	}
+}
+
+func TestKeyringNonceIsRandom(t *testing.T) {
+	k := mustKeyring(t, testKeyA)
+
+	first, _ := k.encrypt("same")
+	second, _ := k.encrypt("same")
+	if first == second {
+		t.Fatal("encrypting the same plaintext twice produced the same ciphertext")
+	}
+}
+
+func TestKeyringOldKeyDecrypts(t *testing.T) {
+	sealed, err := mustKeyring(t, testKeyB).encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换后旧密钥只用于解密
+	rotated := mustKeyring(t, testKeyA, testKeyB)
+	opened, err := rotated.decrypt(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != "secret" {
+		t.Fatalf("decrypt = %q, want %q", opened, "secret")
+	}
+
+	// 移除旧密钥后无法解密
+	_, err = mustKeyring(t, testKeyA).decrypt(sealed)
+	if !errors.Is(err, errUnknownKey) {
+		t.Fatalf("decrypt without old key: err = %v, want %v", err, errUnknownKey)
+	}
+}
+
+func TestKeyringPlaintextPassthrough(t *testing.T) {
+	k := mustKeyring(t, testKeyA)
+
+	for _, plaintext := range []string{"", "plain text", "enc:v0:not ours"} {
+		opened, err := k.decrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened != plaintext {
+			t.Fatalf("decrypt(%q) = %q, want unchanged", plaintext, opened)
+		}
+	}
+}
+
+func TestKeyringRejectsTamperedCiphertext(t *testing.T) {
+	k := mustKeyring(t, testKeyA)
+
+	sealed, _ := k.encrypt("secret")
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if tampered == sealed {
+		tampered = sealed[:len(sealed)-2] + "BB"
+	}
+	if _, err := k.decrypt(tampered); err == nil {
+		t.Fatal("decrypt of tampered ciphertext succeeded")
+	}
+}
+
+func TestNewKeyringRejectsInvalidKeys(t *testing.T) {
+	if _, err := newKeyring(nil); err == nil {
+		t.Fatal("newKeyring(nil) succeeded")
+	}
+	if _, err := newKeyring([][]byte{[]byte("short")}); err == nil {
+		t.Fatal("newKeyring with a 5 byte key succeeded")
+	}
+}
+
+func TestEncryptedStoreMigrateRewraps(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+
+	// 启用加密之前写入的明文
+	if err := inner.CreateMemory(ctx, 1, "plain memory"); err != nil {
+		t.Fatal(err)
+	}
+	// 使用旧密钥加密的数据
+	old, err := newEncryptedStore(inner, [][]byte{testKeyB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.CreateRound(ctx, &RoundRecord{UserID: 1, Messages: []MessageRecord{{Role: roleUser, Content: "old round"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newEncryptedStore(inner, [][]byte{testKeyA, testKeyB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := mustKeyring(t, testKeyA).primaryPrefix()
+	rawMemories, _ := inner.ListMemories(ctx, 1)
+	rawRounds, _ := inner.ListRecentRounds(ctx, 1, 0)
+	if !strings.HasPrefix(rawMemories[0].Memory, prefix) {
+		t.Fatalf("memory was not encrypted with the primary key: %q", rawMemories[0].Memory)
+	}
+	if !strings.HasPrefix(rawRounds[0].Messages[0].Content, prefix) {
+		t.Fatalf("message was not re-encrypted with the primary key: %q", rawRounds[0].Messages[0].Content)
+	}
+
+	// 重新加密后只需要新密钥
+	rotated, err := newEncryptedStore(inner, [][]byte{testKeyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memories, err := rotated.ListMemories(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rounds, err := rotated.ListRecentRounds(ctx, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memories[0].Memory != "plain memory" || rounds[0].Messages[0].Content != "old round" {
+		t.Fatalf("unexpected content after rewrap: %q, %q", memories[0].Memory, rounds[0].Messages[0].Content)
+	}
+}
@@ -0,0 +1,230 @@
+package atri
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// exportVersion 是导出格式的版本
+const exportVersion = 1
+
+// ExportData 是导出的用户数据
+type ExportData struct {
+	Version    int            `json:"version"`
+	UserID     int64          `json:"user_id"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Memories   []ExportMemory `json:"memories"`
+	Rounds     []ExportRound  `json:"rounds"`
+}
+
+// ExportMemory 是导出的一条记忆
+type ExportMemory struct {
+	Memory    string    `json:"memory"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportRound 是导出的一轮对话
+type ExportRound struct {
+	CreatedAt        time.Time       `json:"created_at"`
+	Model            string          `json:"model,omitempty"`
+	PromptTokens     int64           `json:"prompt_tokens,omitempty"`
+	CompletionTokens int64           `json:"completion_tokens,omitempty"`
+	Messages         []ExportMessage `json:"messages"`
+}
+
+// ExportMessage 是导出的一条消息
+type ExportMessage struct {
+	Role       string          `json:"role"`
+	Content    string          `json:"content"`
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// exportRange 是导出的范围, 两者都为零值时导出全部
+type exportRange struct {
+	since     time.Time // 只导出该时间之后的对话
+	lastCount int       // 只导出最近的若干轮对话
+}
+
+// parseExportRange 解析导出范围: all、时长(如7d/24h)或最近的轮数
+func parseExportRange(s string) (exportRange, error) {
+	if s == "" || strings.ToLower(s) == "all" {
+		return exportRange{}, nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return exportRange{}, fmt.Errorf("轮数必须大于0: %s", s)
+		}
+		return exportRange{lastCount: n}, nil
+	}
+
+	d, err := parseDuration(s)
+	if err != nil {
+		return exportRange{}, err
+	}
+	return exportRange{since: time.Now().Add(-d)}, nil
+}
+
+// ExportUser 将用户的全部对话历史和记忆以JSON格式写入w
+func (a *Atri) ExportUser(ctx context.Context, userID int64, w io.Writer) error {
+	data, err := a.collectExportData(ctx, userID, exportRange{})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// collectExportData 收集用户在某个范围内的对话历史和记忆
+func (a *Atri) collectExportData(ctx context.Context, userID int64, rng exportRange) (ExportData, error) {
+	data := ExportData{
+		Version:    exportVersion,
+		UserID:     userID,
+		ExportedAt: time.Now(),
+		Memories:   []ExportMemory{},
+		Rounds:     []ExportRound{},
+	}
+
+	memories, err := a.store.ListMemories(ctx, userID)
+	if err != nil {
+		return ExportData{}, err
+	}
+	for _, m := range memories {
+		data.Memories = append(data.Memories, ExportMemory{Memory: m.Memory, CreatedAt: m.CreatedAt})
+	}
+
+	rounds, err := a.store.ListRoundsSince(ctx, userID, rng.since)
+	if err != nil {
+		return ExportData{}, err
+	}
+	if rng.lastCount > 0 && len(rounds) > rng.lastCount {
+		rounds = rounds[len(rounds)-rng.lastCount:]
+	}
+
+	for _, round := range rounds {
+		messages := round.Messages
+		if len(messages) == 0 {
+			history, err := round.history()
+			if err != nil {
+				return ExportData{}, err
+			}
+			messages, err = roundToMessages(history)
+			if err != nil {
+				return ExportData{}, err
+			}
+		}
+
+		exported := ExportRound{
+			CreatedAt:        round.CreatedAt,
+			Model:            round.ModelName,
+			PromptTokens:     round.PromptTokens,
+			CompletionTokens: round.CompletionTokens,
+			Messages:         []ExportMessage{},
+		}
+		for _, m := range messages {
+			msg := ExportMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+			if m.ToolCalls != "" {
+				msg.ToolCalls = json.RawMessage(m.ToolCalls)
+			}
+			exported.Messages = append(exported.Messages, msg)
+		}
+		data.Rounds = append(data.Rounds, exported)
+	}
+
+	return data, nil
+}
+
+// renderExportMarkdown 将导出数据渲染为便于阅读的Markdown, 会省略系统消息
+func (a *Atri) renderExportMarkdown(ctx context.Context, data ExportData) []byte {
+	var sb strings.Builder
+
+	sb.WriteString(a.t(ctx, "export.md.header", data.UserID, data.ExportedAt.Format(time.DateTime)))
+
+	sb.WriteString(a.t(ctx, "export.md.memories"))
+	if len(data.Memories) == 0 {
+		sb.WriteString(a.t(ctx, "export.md.no_memories"))
+	}
+	for _, m := range data.Memories {
+		fmt.Fprintf(&sb, "- %s\n", m.Memory)
+	}
+
+	sb.WriteString(a.t(ctx, "export.md.rounds"))
+	for _, round := range data.Rounds {
+		fmt.Fprintf(&sb, "\n### %s\n\n", round.CreatedAt.Format(time.DateTime))
+		for _, m := range round.Messages {
+			switch m.Role {
+			case roleUser:
+				sb.WriteString(a.t(ctx, "export.md.user", m.Content))
+			case roleAssistant:
+				if m.Content != "" {
+					fmt.Fprintf(&sb, "**Atri**: %s\n\n", m.Content)
+				}
+				if len(m.ToolCalls) > 0 {
+					sb.WriteString(a.t(ctx, "export.md.tool_calls", m.ToolCalls))
+				}
+			case roleTool:
+				sb.WriteString(a.t(ctx, "export.md.tool_result", m.Content))
+			}
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+func (a *Atri) handleExport(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	format := "json"
+	if len(args) >= 1 {
+		format = strings.ToLower(args[0])
+	}
+	if format == "markdown" {
+		format = "md"
+	}
+	if format != "json" && format != "md" {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "export.usage"), false)
+		return err
+	}
+
+	rangeStr := ""
+	if len(args) >= 2 {
+		rangeStr = args[1]
+	}
+	rng, err := parseExportRange(rangeStr)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "export.invalid_range"), false)
+		return err
+	}
+
+	data, err := a.collectExportData(ctx, userID, rng)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if format == "md" {
+		content = a.renderExportMarkdown(ctx, data)
+	} else {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+		content = buf.Bytes()
+	}
+
+	filename := fmt.Sprintf("atri-export-%d-%s.%s", userID, data.ExportedAt.Format("20060102-150405"), format)
+	caption := a.t(ctx, "export.done", len(data.Rounds), len(data.Memories))
+	_, err = a.sendDocument(ctx, bt, chatID, filename, content, caption)
+	return err
+}
@@ -2,8 +2,8 @@ package atri
 
 import (
 	"context"
-	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/chhongzh/shlex"
 	"github.com/go-telegram/bot"
@@ -11,13 +11,45 @@ import (
 	"go.uber.org/zap"
 )
 
-func (a *Atri) handlerForTextMessage(ctx context.Context, bt *bot.Bot, update *models.Update) {
-	chatID := update.Message.Chat.ID
-	chatText := strings.TrimSpace(update.Message.Text)
-	username := update.Message.Chat.Username
-	userID := update.Message.From.ID
+func (a *Atri) handlerForTextMessage(ctx context.Context, bt *bot.Bot, message *models.Message) {
+	// 频道或匿名管理员的消息没有发送者
+	if message.From == nil {
+		return
+	}
+
+	chatID := message.Chat.ID
+	chatText := strings.TrimSpace(message.Text)
+	username := message.Chat.Username
+	userID := message.From.ID
+
+	if chatText == "" && message.Document == nil {
+		return
+	}
+
+	ctx = withLanguage(ctx, a.resolveLanguage(ctx, userID, message.From.LanguageCode))
+
+	// 被封禁的用户不能使用邀请码、提交申请或对话
+	if a.checkBanned(ctx, bt, chatID, userID) {
+		return
+	}
+
+	if startArgs := strings.Fields(chatText); len(startArgs) > 0 && strings.ToLower(startArgs[0]) == "/start" {
+		if len(startArgs) >= 2 {
+			if a.handleSetupToken(ctx, bt, chatID, userID, startArgs[1]) {
+				return
+			}
+
+			inBuck, err := a.hasUser(ctx, userID)
+			if err != nil {
+				a.sendError(ctx, bt, chatID, err)
+				return
+			}
+			if !inBuck {
+				a.handleInviteRedeem(ctx, bt, chatID, userID, username, startArgs[1])
+				return
+			}
+		}
 
-	if strings.ToLower(chatText) == "/start" {
 		if !a.isUserInBuck(ctx, userID) {
 			a.logger.Info("一名新的用户!",
 				zap.Int64("Chat ID", chatID),
@@ -25,16 +57,17 @@ func (a *Atri) handlerForTextMessage(ctx context.Context, bt *bot.Bot, update *m
 				zap.Int64("UserID", userID),
 			)
 
-			a.sendMessageTo(ctx, bt, chatID, fmt.Sprintf("未在白名单内, 请联系管理员, UserID=%d.", chatID), false)
+			a.handleAccessRequest(ctx, bt, chatID, userID, username)
 			return
 		}
 
-		a.sendMessageTo(ctx, bt, chatID, fmt.Sprintf("%s, 欢迎回来!", username), false)
+		a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "welcome_back", username), false)
 		return
 	}
 
 	if !a.isUserInBuck(ctx, userID) {
 		// Silent 处理
+		a.auditAccessDenied(ctx, userID, "message")
 		return
 	}
 
@@ -45,6 +78,15 @@ func (a *Atri) handlerForTextMessage(ctx context.Context, bt *bot.Bot, update *m
 		zap.String("Chat Text", chatText),
 	)
 
+	if message.Document != nil {
+		err := a.handleDocument(ctx, bt, message)
+		if err != nil {
+			a.sendError(ctx, bt, chatID, err)
+		}
+
+		return
+	}
+
 	if strings.HasPrefix(chatText, "/") {
 		commandLine := strings.TrimSpace(chatText[1:])
 		err := a.handleCommand(ctx, bt, chatID, commandLine, userID)
@@ -55,14 +97,55 @@ func (a *Atri) handlerForTextMessage(ctx context.Context, bt *bot.Bot, update *m
 		return
 	}
 
-	err := a.handleAiChat(ctx, bt, userID, username, chatID, chatText)
+	limitMsg, err := a.checkQuota(ctx, userID)
 	if err != nil {
 		a.sendError(ctx, bt, chatID, err)
 		return
 	}
+	if limitMsg != "" {
+		a.sendMessageTo(ctx, bt, chatID, limitMsg, false)
+		return
+	}
+
+	err = a.handleAiChat(ctx, bt, userID, username, chatID, message.Chat.Type, chatText, message.ID, 0)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+}
+
+// rawTextCommands 是需要读取原始参数的命令, 参数中的引号和换行不经过shlex处理, 通过commandText读取
+var rawTextCommands = map[string]bool{
+	"broadcast": true,
+	"schedule":  true,
+}
+
+// commandTextKey 是context中保存命令原始参数的键
+type commandTextKey struct{}
+
+// commandText 返回命令名之后的原始文本, 只对rawTextCommands中的命令可用
+func commandText(ctx context.Context) string {
+	text, _ := ctx.Value(commandTextKey{}).(string)
+	return text
+}
+
+// cutFirstWord 分出第一个单词和之后去掉首尾空白的原始文本
+func cutFirstWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
 }
 
 func (a *Atri) handleCommand(ctx context.Context, bt *bot.Bot, chatID int64, commandLine string, userID int64) error {
+	command, text := cutFirstWord(commandLine)
+	if rawTextCommands[command] {
+		ctx = context.WithValue(ctx, commandTextKey{}, text)
+		return a.executeCommand(ctx, bt, command, chatID, userID, strings.Fields(text))
+	}
+
 	parts, err := shlex.Split(commandLine)
 	if err != nil {
 		return err
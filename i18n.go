@@ -0,0 +1,628 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// 内置的语言
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+// languageKey 是context中保存当前用户语言的键
+type languageKey struct{}
+
+// messageCatalog 是内置的消息目录: 语言 -> 消息键 -> 文本, 文本中可以使用fmt的占位符
+var messageCatalog = map[string]map[string]string{
+	LangZh: {
+		"help": `下面的指令是支持的喵~
+/help 显示这条命令
+/info 查看对话信息
+/memory ls 列出所有memory
+/memory rm <ID> 删除memory (需要确认)
+/export [json|md] [all|时长|轮数] 导出对话记录
+/import 导入对话记录 (也可以直接发送带有/import说明的文件)
+/search <关键词> 查找历史对话
+/remind ls 列出你的提醒
+/remind rm <ID> 删除提醒
+/schedule ls 列出你的定时提示词
+/schedule add "<cron表达式>" <提示词> 定时以提示词发起对话
+/schedule rm <ID> 删除定时提示词
+/settings [tz|lang] [值|reset] 查看或修改个人设置 (时区和语言)
+/forgetme 删除你的全部对话、记忆、提醒、定时提示词和设置 (需要确认)
+/user ls 列出所有用户
+/user add <ID> [admin] 添加用户
+/user rm <ID> [--purge] 删除用户, --purge 会同时删除其对话和记忆 (需要确认)
+/user setadmin <ID> <true|false> 设置管理员
+/user role <ID> [角色] 查看或设置用户的角色
+/user ban [ID] [时长] [原因] 封禁用户, 不带参数时列出被封禁的用户
+/user unban <ID> 解除封禁
+/usage [天数] 查看所有用户的用量
+/audit [条数] 查看最近的审计日志
+/broadcast <内容> 向所有用户广播消息 (需要确认)
+/quota [ID] 查看额度
+/quota set <ID> <rpm|tokens|cost> <值|default> 设置用户额度
+/invite create [次数] [有效期] [admin] 创建邀请码
+/invite ls 列出可用的邀请码
+/invite revoke <邀请码> 撤销邀请码`,
+		"info": `信息
+
+当前内存中的轮数:%d
+配置的最大轮数:%s
+数据库中的总消息数量:%d
+已经存储的记忆数量:%d
+模型:%s
+今日用量:%s
+本月用量:%s
+`,
+		"info.unlimited":        "无限制",
+		"welcome_back":          "%s, 欢迎回来!",
+		"unknown_command":       ">_< 不理解你在说啥喵",
+		"no_permission_command": "没有权限执行该命令喵~",
+		"no_permission_action":  "没有权限执行该操作喵~",
+		"invalid_page":          "无效的页码喵~",
+		"invalid_id":            "无效的ID喵~",
+		"id_not_number":         "ID必须是数字喵~",
+		"user_id_not_number":    "用户ID必须是数字喵~",
+		"deleted":               "删除成功喵!",
+		"invalid_action":        "无效的操作喵~",
+		"not_in_allowlist":      "未在白名单内喵~",
+		"banned":                "你已被封禁喵~",
+		"message_expired":       "消息已过期喵~",
+		"cancelled":             "已取消喵~",
+		"cancelled.short":       "已取消",
+		"callback_error":        ">_< 出错了喵",
+		"confirm":               "确认",
+		"cancel":                "取消",
+		"page.prev":             "上一页",
+		"page.next":             "下一页",
+
+		"memory.unknown_subcommand": "未知子命令喵~ 请使用 ls (list) 或 rm (remove)",
+		"memory.empty":              "没有记忆喵~",
+		"memory.page": `所有的记忆 (%d/%d)
+
+%s
+如果要删除某条记忆, 请输入/memory rm <ID>`,
+		"memory.rm.missing_id": "请输入要删除的记忆ID喵~",
+		"memory.rm.failed":     "无法删除记忆喵~ 请确认ID是否正确且属于你自己",
+		"memory.rm.confirm":    "确定要删除这条记忆吗?\n\nID: %d - %s",
+
+		"user.unknown_subcommand": "未知子命令喵~ 请使用 ls/add/rm/setadmin/role/ban/unban",
+		"user.empty":              "没有任何用户喵~",
+		"user.page":               "所有的用户 (%d/%d)\n\n%s",
+		"user.add.missing_id":     "请输入要添加的用户ID喵~",
+		"user.add.banned":         "该用户已被封禁喵~ (%s) 请先使用 /user unban 解除封禁",
+		"user.add.success":        "添加用户成功喵!",
+		"user.rm.missing_id":      "请输入要删除的用户ID喵~",
+		"user.rm.confirm":         "确定要删除用户 %d 吗?",
+		"user.rm.confirm_purge":   "确定要删除用户 %d 及其全部对话和记忆吗? 删除后无法恢复喵~",
+		"user.rm.success":         "删除用户成功喵!",
+		"user.rm.success_purge":   "删除用户及其数据成功喵!",
+		"user.setadmin.usage":     "用法: /user setadmin <ID> <true|false>",
+		"user.setadmin.self":      "不可以把自己从管理员降级为普通用户喵~",
+		"user.setadmin.success":   "更新管理员状态成功喵!",
+
+		"settings.show": `你的设置
+
+时区: %s
+语言: %s
+
+/settings tz <时区|reset> 设置时区, 如Asia/Shanghai
+/settings lang <%s|reset> 设置语言`,
+		"settings.default":          "默认",
+		"settings.default_timezone": "默认 (%s)",
+		"settings.usage":            "用法: /settings <tz|lang> <值|reset>",
+		"settings.invalid_timezone": "无效的时区喵~ 请使用IANA时区名, 如Asia/Shanghai",
+		"settings.invalid_language": "不支持的语言喵~ 可用的语言: %s",
+		"settings.unknown":          "未知的设置项喵~ 请使用 tz 或 lang",
+		"settings.saved":            "设置已保存喵!",
+
+		"access.pending":   "你的申请正在等待管理员审核喵~ 请耐心等待",
+		"access.submitted": "未在白名单内, 已向管理员提交申请喵~ UserID=%d.",
+		"access.notice": `新的访问申请喵~
+
+用户名: %s
+UserID: %d`,
+		"access.approve":         "批准",
+		"access.deny":            "拒绝",
+		"access.no_permission":   "没有权限处理申请喵~",
+		"access.decided":         "这个申请已经被处理过了喵~",
+		"access.approved":        "已批准",
+		"access.denied":          "已拒绝",
+		"access.approved.notice": "你的访问申请已被批准喵! 输入 /help 查看可用命令",
+		"access.denied.notice":   "很遗憾, 你的访问申请被拒绝了喵~",
+		"access.decided_by":      "%s\n\n%s (由 %d 处理)",
+
+		"ban.forever":      "永久",
+		"ban.until":        "至 %s",
+		"ban.with_reason":  "%s, 原因: %s",
+		"ban.notice":       "你已被封禁喵~ (%s)",
+		"ban.usage":        "用法: /user ban <ID> [时长, 如24h/7d] [原因]",
+		"ban.self":         "不可以封禁自己喵~",
+		"ban.success":      "已封禁用户 %d 喵! (%s)",
+		"ban.empty":        "没有被封禁的用户喵~\n\n用法: /user ban <ID> [时长, 如24h/7d] [原因]",
+		"ban.list":         "被封禁的用户\n\n%s",
+		"unban.missing_id": "请输入要解除封禁的用户ID喵~",
+		"unban.success":    "解除封禁成功喵!",
+		"bootstrap.admin":  "你已经成为管理员喵! 输入 /help 查看可用命令",
+
+		"audit.usage":            "用法: /audit [条数]",
+		"audit.empty":            "没有任何审计日志喵~",
+		"audit.list":             "最近的%d条审计日志\n\n%s",
+		"broadcast.usage":        "用法: /broadcast <内容>",
+		"broadcast.preview":      "预览: 下面的消息将发送给%d名用户, 确认后开始发送喵~",
+		"broadcast.already_sent": "这条广播已经发送过了喵~",
+		"broadcast.started":      "开始发送",
+		"broadcast.summary": `广播完成喵!
+
+成功: %d
+失败: %d
+跳过(已封禁): %d`,
+		"broadcast.failures": `
+
+失败的用户:
+`,
+		"broadcast.more_failures": "...以及其他%d名用户\n",
+
+		"regen.button":     "重新生成",
+		"regen.not_latest": "只能重新生成最新的回答喵~",
+		"regen.started":    "重新生成中喵~",
+
+		"export.usage":         "用法: /export [json|md] [all|时长|轮数]",
+		"export.invalid_range": "无效的范围喵~ 可以使用 all、7d/24h 这样的时长或者最近的轮数",
+		"export.done":          "导出完成喵~ 共%d轮对话, %d条记忆",
+		"export.md.header": `# 对话记录
+
+用户: %d
+导出时间: %s
+
+`,
+		"export.md.memories":    "## 记忆\n\n",
+		"export.md.no_memories": "没有记忆\n",
+		"export.md.rounds":      "\n## 对话\n",
+		"export.md.user":        "**用户**: %s\n\n",
+		"export.md.tool_calls":  "> 工具调用: `%s`\n\n",
+		"export.md.tool_result": "> 工具结果: %s\n\n",
+
+		"invite.unknown_subcommand": "未知子命令喵~ 请使用 create/ls/revoke",
+		"invite.invalid_uses":       "可用次数必须大于0喵~",
+		"invite.create.usage":       "用法: /invite create [次数] [有效期, 如24h/7d] [admin]",
+		"invite.create.success": `邀请码创建成功喵!
+
+邀请码: %s
+`,
+		"invite.create.link":         "链接: https://t.me/%s?start=%s\n",
+		"invite.create.start":        "也可以发送 /start %s 使用",
+		"invite.forever":             "永久",
+		"invite.list":                "可用的邀请码\n\n%s",
+		"invite.list.item":           "%s - %s - %d/%d - 有效期至%s\n",
+		"invite.list.empty":          "没有可用的邀请码喵~",
+		"invite.revoke.missing_code": "请输入要撤销的邀请码喵~",
+		"invite.revoke.failed":       "无法撤销邀请码喵~ 请确认邀请码是否正确",
+		"invite.revoke.success":      "撤销成功喵!",
+		"invite.redeem.invalid":      "邀请码无效或已过期喵~ 请联系管理员",
+		"invite.redeem.success":      "%s, 欢迎加入! 输入 /help 查看可用命令喵~",
+
+		"import.prompt":          "请发送通过 /export 导出的JSON文件, 或者OpenAI格式的消息数组喵~",
+		"import.unexpected_file": "暂时看不懂文件喵~ 如果要导入对话记录, 请先发送 /import",
+		"import.too_large":       "文件太大了喵~",
+		"import.failed":          "导入失败喵~ %s",
+		"import.success":         "导入成功喵! 共导入%d轮对话, %d条记忆",
+
+		"quota.tokens_exhausted":   "今天的Token额度(%d)已经用完了喵~ 明天再来找我玩吧",
+		"quota.cost_exhausted":     "本月的费用额度(%.2f)已经用完了喵~ 请联系管理员",
+		"quota.rate_limited":       "说话太快了喵~ 请%d秒后再试",
+		"quota.description":        "每分钟消息数:%s\n每日Token数:%s\n每月费用:%s",
+		"quota.show":               "用户%d的额度\n\n%s",
+		"quota.no_permission_view": "没有权限查看其他用户的额度喵~",
+		"quota.set.usage":          "用法: /quota set <ID> <rpm|tokens|cost> <值|default>",
+		"quota.invalid_integer":    "额度必须是非负整数喵~",
+		"quota.invalid_number":     "额度必须是非负数喵~",
+		"quota.unknown_item":       "未知额度项喵~ 请使用 rpm/tokens/cost",
+		"quota.set.success":        "更新额度成功喵!",
+
+		"recurrence.once":           "一次",
+		"recurrence.daily":          "每天",
+		"recurrence.weekly":         "每周",
+		"recurrence.monthly":        "每月",
+		"remind.notice":             "提醒喵~\n\n%s",
+		"remind.unknown_subcommand": "未知子命令喵~ 请使用 ls (list) 或 rm (remove)",
+		"remind.empty":              "没有任何提醒喵~ 直接告诉我要提醒什么就好",
+		"remind.list":               "你的提醒\n\n%s",
+		"remind.rm.missing_id":      "请输入要删除的提醒ID喵~",
+		"remind.rm.not_found":       "找不到该提醒喵~ 请确认ID是否正确",
+
+		"forgetme.confirm": "确定要删除你的全部对话、记忆、提醒、定时提示词、设置和访问申请吗? 删除后无法恢复喵~",
+		"forgetme.done":    "已经忘记了关于你的一切喵...",
+
+		"role.usage": `用法: /user role <ID> [角色]
+
+所有的角色:
+`,
+		"role.user_not_found": "找不到该用户喵~",
+		"role.show":           "用户 %d 的角色是 %s",
+		"role.unknown":        "未知的角色喵~ 可用的角色: %s",
+		"role.self":           "不可以移除自己管理用户的权限喵~",
+		"role.success":        "更新角色成功喵!",
+
+		"usage.summary": "%d轮 / 输入%d / 输出%d / 费用%.4f",
+		"usage.usage":   "用法: /usage [天数]",
+		"usage.empty":   "没有任何用量喵~\n",
+		"usage.list": `最近%d天的用量
+
+%s
+合计: %s`,
+
+		"search.user":      "用户",
+		"search.usage":     "用法: /search <关键词>",
+		"search.too_long":  "关键词太长了喵~",
+		"search.not_found": "没有找到包含\"%s\"的对话喵~",
+		"search.result":    "找到以下对话(最多显示%d条):\n%s",
+
+		"schedule.usage":              "用法: /schedule add \"<分 时 日 月 周>\" <提示词>\n例如: /schedule add \"0 8 * * *\" 总结一下我的待办事项",
+		"schedule.unknown_subcommand": "未知子命令喵~ 请使用 ls/add/rm",
+		"schedule.invalid_spec":       "无效的cron表达式喵~ %s\n\n%s",
+		"schedule.too_many":           "最多只能有%d个定时提示词喵~",
+		"schedule.added":              "添加成功喵! (ID %d) 下一次执行时间: %s",
+		"schedule.empty":              "没有任何定时提示词喵~\n\n%s",
+		"schedule.list":               "你的定时提示词\n\n%s",
+		"schedule.list.item": `ID: %d - %s (下一次: %s)
+%s
+
+`,
+		"schedule.rm.missing_id": "请输入要删除的定时提示词ID喵~",
+		"schedule.rm.not_found":  "找不到该定时提示词喵~ 请确认ID是否正确",
+		"schedule.skipped":       "定时提示词(ID %d)未执行: %s",
+
+		"audit.truncated": "\n消息过长, 共%d条, 只显示了最近的部分, 可以减少条数喵~",
+
+		"access.cooldown": "你的访问申请已被拒绝, 请在%s之后再申请喵~",
+
+		"role.above_self": "不能授予比自己更多的权限, 也不能管理权限比自己多的用户喵~",
+	},
+	LangEn: {
+		"help": `Here are the supported commands, meow~
+/help Show this message
+/info Show conversation info
+/memory ls List all memories
+/memory rm <ID> Delete a memory (asks for confirmation)
+/export [json|md] [all|duration|rounds] Export your conversations
+/import Import conversations (or just send a file captioned /import)
+/search <keywords> Search your conversation history
+/remind ls List your reminders
+/remind rm <ID> Delete a reminder
+/schedule ls List your scheduled prompts
+/schedule add "<cron expression>" <prompt> Run a prompt on a schedule
+/schedule rm <ID> Delete a scheduled prompt
+/settings [tz|lang] [value|reset] Show or change your settings (timezone and language)
+/forgetme Delete all your conversations, memories, reminders, scheduled prompts and settings (asks for confirmation)
+/user ls List all users
+/user add <ID> [admin] Add a user
+/user rm <ID> [--purge] Remove a user, --purge also deletes their conversations and memories (asks for confirmation)
+/user setadmin <ID> <true|false> Grant or revoke admin
+/user role <ID> [role] Show or set a user's role
+/user ban [ID] [duration] [reason] Ban a user, lists banned users without arguments
+/user unban <ID> Lift a ban
+/usage [days] Show usage of all users
+/audit [count] Show recent audit log entries
+/broadcast <text> Send a message to all users (asks for confirmation)
+/quota [ID] Show quota
+/quota set <ID> <rpm|tokens|cost> <value|default> Set a user's quota
+/invite create [uses] [expiry] [admin] Create an invite code
+/invite ls List usable invite codes
+/invite revoke <code> Revoke an invite code`,
+		"info": `Info
+
+Rounds in memory: %d
+Max rounds: %s
+Rounds in database: %d
+Stored memories: %d
+Model: %s
+Usage today: %s
+Usage this month: %s
+`,
+		"info.unlimited":        "unlimited",
+		"welcome_back":          "Welcome back, %s!",
+		"unknown_command":       ">_< I don't understand that, meow",
+		"no_permission_command": "You don't have permission to run this command, meow~",
+		"no_permission_action":  "You don't have permission to do this, meow~",
+		"invalid_page":          "Invalid page, meow~",
+		"invalid_id":            "Invalid ID, meow~",
+		"id_not_number":         "The ID must be a number, meow~",
+		"user_id_not_number":    "The user ID must be a number, meow~",
+		"deleted":               "Deleted, meow!",
+		"invalid_action":        "Invalid action, meow~",
+		"not_in_allowlist":      "You are not on the allowlist, meow~",
+		"banned":                "You have been banned, meow~",
+		"message_expired":       "This message has expired, meow~",
+		"cancelled":             "Cancelled, meow~",
+		"cancelled.short":       "Cancelled",
+		"callback_error":        ">_< Something went wrong, meow",
+		"confirm":               "Confirm",
+		"cancel":                "Cancel",
+		"page.prev":             "Previous",
+		"page.next":             "Next",
+
+		"memory.unknown_subcommand": "Unknown subcommand, meow~ Use ls (list) or rm (remove)",
+		"memory.empty":              "No memories yet, meow~",
+		"memory.page": `All memories (%d/%d)
+
+%s
+To delete a memory, send /memory rm <ID>`,
+		"memory.rm.missing_id": "Please give the ID of the memory to delete, meow~",
+		"memory.rm.failed":     "Couldn't delete the memory, meow~ Make sure the ID is correct and belongs to you",
+		"memory.rm.confirm":    "Delete this memory?\n\nID: %d - %s",
+
+		"user.unknown_subcommand": "Unknown subcommand, meow~ Use ls/add/rm/setadmin/role/ban/unban",
+		"user.empty":              "No users yet, meow~",
+		"user.page":               "All users (%d/%d)\n\n%s",
+		"user.add.missing_id":     "Please give the ID of the user to add, meow~",
+		"user.add.banned":         "This user is banned, meow~ (%s) Lift the ban with /user unban first",
+		"user.add.success":        "User added, meow!",
+		"user.rm.missing_id":      "Please give the ID of the user to remove, meow~",
+		"user.rm.confirm":         "Remove user %d?",
+		"user.rm.confirm_purge":   "Remove user %d and delete all their conversations and memories? This cannot be undone, meow~",
+		"user.rm.success":         "User removed, meow!",
+		"user.rm.success_purge":   "User and their data removed, meow!",
+		"user.setadmin.usage":     "Usage: /user setadmin <ID> <true|false>",
+		"user.setadmin.self":      "You can't demote yourself, meow~",
+		"user.setadmin.success":   "Admin status updated, meow!",
+
+		"settings.show": `Your settings
+
+Timezone: %s
+Language: %s
+
+/settings tz <timezone|reset> Set your timezone, e.g. Europe/London
+/settings lang <%s|reset> Set your language`,
+		"settings.default":          "default",
+		"settings.default_timezone": "default (%s)",
+		"settings.usage":            "Usage: /settings <tz|lang> <value|reset>",
+		"settings.invalid_timezone": "Invalid timezone, meow~ Use an IANA name such as Europe/London",
+		"settings.invalid_language": "Unsupported language, meow~ Available: %s",
+		"settings.unknown":          "Unknown setting, meow~ Use tz or lang",
+		"settings.saved":            "Settings saved, meow!",
+
+		"access.pending":   "Your request is waiting for an admin to review it, meow~ Please be patient",
+		"access.submitted": "You are not on the allowlist, so a request has been sent to the admins, meow~ UserID=%d.",
+		"access.notice": `New access request, meow~
+
+Username: %s
+UserID: %d`,
+		"access.approve":         "Approve",
+		"access.deny":            "Deny",
+		"access.no_permission":   "You don't have permission to handle requests, meow~",
+		"access.decided":         "This request has already been handled, meow~",
+		"access.approved":        "Approved",
+		"access.denied":          "Denied",
+		"access.approved.notice": "Your access request was approved, meow! Send /help to see the available commands",
+		"access.denied.notice":   "Sorry, your access request was denied, meow~",
+		"access.decided_by":      "%s\n\n%s (by %d)",
+
+		"ban.forever":      "permanent",
+		"ban.until":        "until %s",
+		"ban.with_reason":  "%s, reason: %s",
+		"ban.notice":       "You have been banned, meow~ (%s)",
+		"ban.usage":        "Usage: /user ban <ID> [duration, e.g. 24h/7d] [reason]",
+		"ban.self":         "You can't ban yourself, meow~",
+		"ban.success":      "User %d has been banned, meow! (%s)",
+		"ban.empty":        "No users are banned, meow~\n\nUsage: /user ban <ID> [duration, e.g. 24h/7d] [reason]",
+		"ban.list":         "Banned users\n\n%s",
+		"unban.missing_id": "Please give the ID of the user to unban, meow~",
+		"unban.success":    "Ban lifted, meow!",
+		"bootstrap.admin":  "You are now an admin, meow! Send /help to see the available commands",
+
+		"audit.usage":            "Usage: /audit [count]",
+		"audit.empty":            "The audit log is empty, meow~",
+		"audit.list":             "The latest %d audit log entries\n\n%s",
+		"broadcast.usage":        "Usage: /broadcast <text>",
+		"broadcast.preview":      "Preview: the message below will be sent to %d users once you confirm, meow~",
+		"broadcast.already_sent": "This broadcast has already been sent, meow~",
+		"broadcast.started":      "Sending",
+		"broadcast.summary": `Broadcast finished, meow!
+
+Sent: %d
+Failed: %d
+Skipped (banned): %d`,
+		"broadcast.failures": `
+
+Failed users:
+`,
+		"broadcast.more_failures": "...and %d more\n",
+
+		"regen.button":     "Regenerate",
+		"regen.not_latest": "Only the latest answer can be regenerated, meow~",
+		"regen.started":    "Regenerating, meow~",
+
+		"export.usage":         "Usage: /export [json|md] [all|duration|rounds]",
+		"export.invalid_range": "Invalid range, meow~ Use all, a duration such as 7d/24h, or a number of recent rounds",
+		"export.done":          "Export finished, meow~ %d rounds and %d memories",
+		"export.md.header": `# Conversation history
+
+User: %d
+Exported at: %s
+
+`,
+		"export.md.memories":    "## Memories\n\n",
+		"export.md.no_memories": "No memories\n",
+		"export.md.rounds":      "\n## Conversations\n",
+		"export.md.user":        "**User**: %s\n\n",
+		"export.md.tool_calls":  "> Tool calls: `%s`\n\n",
+		"export.md.tool_result": "> Tool result: %s\n\n",
+
+		"invite.unknown_subcommand": "Unknown subcommand, meow~ Use create/ls/revoke",
+		"invite.invalid_uses":       "The number of uses must be greater than 0, meow~",
+		"invite.create.usage":       "Usage: /invite create [uses] [expiry, e.g. 24h/7d] [admin]",
+		"invite.create.success": `Invite code created, meow!
+
+Code: %s
+`,
+		"invite.create.link":         "Link: https://t.me/%s?start=%s\n",
+		"invite.create.start":        "It can also be used by sending /start %s",
+		"invite.forever":             "never",
+		"invite.list":                "Usable invite codes\n\n%s",
+		"invite.list.item":           "%s - %s - %d/%d - expires %s\n",
+		"invite.list.empty":          "No usable invite codes, meow~",
+		"invite.revoke.missing_code": "Please give the invite code to revoke, meow~",
+		"invite.revoke.failed":       "Couldn't revoke the invite code, meow~ Make sure the code is correct",
+		"invite.revoke.success":      "Revoked, meow!",
+		"invite.redeem.invalid":      "The invite code is invalid or has expired, meow~ Please contact an admin",
+		"invite.redeem.success":      "Welcome aboard, %s! Send /help to see the available commands, meow~",
+
+		"import.prompt":          "Please send a JSON file exported with /export, or an OpenAI-style message array, meow~",
+		"import.unexpected_file": "I can't read files yet, meow~ To import conversations, send /import first",
+		"import.too_large":       "The file is too large, meow~",
+		"import.failed":          "Import failed, meow~ %s",
+		"import.success":         "Import finished, meow! Imported %d rounds and %d memories",
+
+		"quota.tokens_exhausted":   "You've used up today's token quota (%d), meow~ Come back tomorrow",
+		"quota.cost_exhausted":     "You've used up this month's cost quota (%.2f), meow~ Please contact an admin",
+		"quota.rate_limited":       "You're talking too fast, meow~ Try again in %d seconds",
+		"quota.description":        "Messages per minute: %s\nTokens per day: %s\nCost per month: %s",
+		"quota.show":               "Quota of user %d\n\n%s",
+		"quota.no_permission_view": "You don't have permission to view other users' quotas, meow~",
+		"quota.set.usage":          "Usage: /quota set <ID> <rpm|tokens|cost> <value|default>",
+		"quota.invalid_integer":    "The quota must be a non-negative integer, meow~",
+		"quota.invalid_number":     "The quota must be a non-negative number, meow~",
+		"quota.unknown_item":       "Unknown quota item, meow~ Use rpm/tokens/cost",
+		"quota.set.success":        "Quota updated, meow!",
+
+		"recurrence.once":           "once",
+		"recurrence.daily":          "daily",
+		"recurrence.weekly":         "weekly",
+		"recurrence.monthly":        "monthly",
+		"remind.notice":             "Reminder, meow~\n\n%s",
+		"remind.unknown_subcommand": "Unknown subcommand, meow~ Use ls (list) or rm (remove)",
+		"remind.empty":              "No reminders yet, meow~ Just tell me what to remind you about",
+		"remind.list":               "Your reminders\n\n%s",
+		"remind.rm.missing_id":      "Please give the ID of the reminder to delete, meow~",
+		"remind.rm.not_found":       "Reminder not found, meow~ Make sure the ID is correct",
+
+		"forgetme.confirm": "Delete all your conversations, memories, reminders, scheduled prompts, settings and access requests? This cannot be undone, meow~",
+		"forgetme.done":    "I've forgotten everything about you, meow...",
+
+		"role.usage": `Usage: /user role <ID> [role]
+
+All roles:
+`,
+		"role.user_not_found": "User not found, meow~",
+		"role.show":           "User %d has the role %s",
+		"role.unknown":        "Unknown role, meow~ Available roles: %s",
+		"role.self":           "You can't remove your own permission to manage users, meow~",
+		"role.success":        "Role updated, meow!",
+
+		"usage.summary": "%d rounds / %d in / %d out / cost %.4f",
+		"usage.usage":   "Usage: /usage [days]",
+		"usage.empty":   "No usage yet, meow~\n",
+		"usage.list": `Usage in the last %d days
+
+%s
+Total: %s`,
+
+		"search.user":      "User",
+		"search.usage":     "Usage: /search <keywords>",
+		"search.too_long":  "The keywords are too long, meow~",
+		"search.not_found": "No conversations contain \"%s\", meow~",
+		"search.result":    "Found these conversations (showing at most %d):\n%s",
+
+		"schedule.usage":              "Usage: /schedule add \"<min hour day month weekday>\" <prompt>\nExample: /schedule add \"0 8 * * *\" Summarize my to-do list",
+		"schedule.unknown_subcommand": "Unknown subcommand, meow~ Use ls/add/rm",
+		"schedule.invalid_spec":       "Invalid cron expression, meow~ %s\n\n%s",
+		"schedule.too_many":           "You can have at most %d scheduled prompts, meow~",
+		"schedule.added":              "Added, meow! (ID %d) Next run: %s",
+		"schedule.empty":              "No scheduled prompts yet, meow~\n\n%s",
+		"schedule.list":               "Your scheduled prompts\n\n%s",
+		"schedule.list.item": `ID: %d - %s (next: %s)
+%s
+
+`,
+		"schedule.rm.missing_id": "Please give the ID of the scheduled prompt to delete, meow~",
+		"schedule.rm.not_found":  "Scheduled prompt not found, meow~ Make sure the ID is correct",
+		"schedule.skipped":       "Scheduled prompt (ID %d) was skipped: %s",
+
+		"audit.truncated": "\nThe message is too long; only the latest part of the %d entries is shown, try a smaller count, meow~",
+
+		"access.cooldown": "Your access request was denied. You can apply again after %s, meow~",
+
+		"role.above_self": "You can't grant more permissions than you have, or manage users with more permissions than you, meow~",
+	},
+}
+
+// languages 返回所有可用的语言, 包括运营者通过Config.Messages添加的语言
+func (a *Atri) languages() []string {
+	langs := slices.Collect(maps.Keys(messageCatalog))
+	for lang := range a.config.Messages {
+		if !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// defaultLanguage 返回配置的默认语言, 未配置时为中文
+func (a *Atri) defaultLanguage() string {
+	if a.config.Language != "" {
+		return a.config.Language
+	}
+	return LangZh
+}
+
+// normalizeLanguage 将Telegram的language_code(如zh-hans, en-US)转换为消息目录中的语言
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	return code
+}
+
+// resolveLanguage 决定用户使用的语言: 依次为用户的设置、Telegram的language_code和默认语言
+func (a *Atri) resolveLanguage(ctx context.Context, userID int64, languageCode string) string {
+	langs := a.languages()
+
+	if lang := a.userSettings(ctx, userID).Language; slices.Contains(langs, lang) {
+		return lang
+	}
+	if lang := normalizeLanguage(languageCode); slices.Contains(langs, lang) {
+		return lang
+	}
+	return a.defaultLanguage()
+}
+
+// withLanguage 将用户的语言保存到context中, 之后通过a.t获取该语言的文本
+func withLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey{}, lang)
+}
+
+// lookupMessage 查找某一语言的文本, 运营者的覆盖优先于内置的消息目录
+func (a *Atri) lookupMessage(lang string, key string) (string, bool) {
+	if text, ok := a.config.Messages[lang][key]; ok {
+		return text, true
+	}
+	text, ok := messageCatalog[lang][key]
+	return text, ok
+}
+
+// t 返回当前用户语言的文本, 缺少该语言的文本时依次使用默认语言和中文, args不为空时按fmt格式化
+func (a *Atri) t(ctx context.Context, key string, args ...any) string {
+	lang, _ := ctx.Value(languageKey{}).(string)
+
+	text := key
+	for _, l := range []string{lang, a.defaultLanguage(), LangZh} {
+		if s, ok := a.lookupMessage(l, key); ok {
+			text = s
+			break
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,387 @@
+package atri
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// maxImportSize 是允许导入的文件大小上限
+const maxImportSize = 10 << 20
+
+// errImportInvalid 表示导入的数据格式不正确
+var errImportInvalid = errors.New("导入的数据格式不正确")
+
+// importMessage 同时兼容导出格式中的消息和OpenAI格式的消息
+type importMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  json.RawMessage `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+type importRound struct {
+	CreatedAt        time.Time       `json:"created_at"`
+	Model            string          `json:"model"`
+	PromptTokens     int64           `json:"prompt_tokens"`
+	CompletionTokens int64           `json:"completion_tokens"`
+	Messages         []importMessage `json:"messages"`
+}
+
+type importData struct {
+	Memories []ExportMemory `json:"memories"`
+	Rounds   []importRound  `json:"rounds"`
+}
+
+// ImportResult 是一次导入的结果
+type ImportResult struct {
+	Rounds   int
+	Memories int
+}
+
+// content 取出消息的文本内容, content可以是字符串或者OpenAI格式的内容片段数组
+func (m importMessage) content() (string, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		return text, nil
+	}
+
+	parts := []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}{}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", fmt.Errorf("%w: 无法解析消息内容", errImportInvalid)
+	}
+
+	texts := []string{}
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// toRecord 校验并将消息转换为MessageRecord
+func (m importMessage) toRecord() (MessageRecord, error) {
+	content, err := m.content()
+	if err != nil {
+		return MessageRecord{}, err
+	}
+
+	record := MessageRecord{
+		Role:       m.Role,
+		Content:    content,
+		ToolCallID: m.ToolCallID,
+	}
+	if len(m.ToolCalls) > 0 && string(m.ToolCalls) != "null" {
+		record.ToolCalls = string(m.ToolCalls)
+	}
+
+	switch m.Role {
+	case roleUser:
+		if content == "" {
+			return MessageRecord{}, fmt.Errorf("%w: 用户消息不能为空", errImportInvalid)
+		}
+	case roleAssistant:
+	case roleTool:
+		if m.ToolCallID == "" {
+			return MessageRecord{}, fmt.Errorf("%w: 工具消息缺少tool_call_id", errImportInvalid)
+		}
+	default:
+		return MessageRecord{}, fmt.Errorf("%w: 不支持的消息角色\"%s\"", errImportInvalid, m.Role)
+	}
+
+	// 确认可以还原为请求参数
+	if _, err := record.toParam(); err != nil {
+		return MessageRecord{}, fmt.Errorf("%w: %s", errImportInvalid, err)
+	}
+
+	return record, nil
+}
+
+// validateToolCalls 校验一轮对话中的每条工具消息都对应之前的助手消息发起的工具调用, 并且每个工具调用都有结果
+func validateToolCalls(messages []MessageRecord) error {
+	pending := map[string]bool{}
+	for _, m := range messages {
+		if m.Role == roleTool {
+			if !pending[m.ToolCallID] {
+				return fmt.Errorf("%w: 工具消息\"%s\"没有对应的工具调用", errImportInvalid, m.ToolCallID)
+			}
+			delete(pending, m.ToolCallID)
+			continue
+		}
+
+		if len(pending) > 0 {
+			return fmt.Errorf("%w: 工具调用缺少结果", errImportInvalid)
+		}
+		if m.Role != roleAssistant || m.ToolCalls == "" {
+			continue
+		}
+
+		toolCalls := []struct {
+			ID string `json:"id"`
+		}{}
+		if err := json.Unmarshal([]byte(m.ToolCalls), &toolCalls); err != nil {
+			return fmt.Errorf("%w: 无法解析tool_calls", errImportInvalid)
+		}
+		for _, tc := range toolCalls {
+			if tc.ID == "" {
+				return fmt.Errorf("%w: 工具调用缺少id", errImportInvalid)
+			}
+			pending[tc.ID] = true
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: 工具调用缺少结果", errImportInvalid)
+	}
+	return nil
+}
+
+// splitIntoRounds 将OpenAI格式的消息数组按用户消息切分为多轮, 第一条用户消息之前的消息归入第一轮
+func splitIntoRounds(messages []importMessage) []importRound {
+	rounds := []importRound{}
+	current := importRound{}
+	hasUser := false
+
+	for _, m := range messages {
+		if m.Role == roleUser && hasUser {
+			rounds = append(rounds, current)
+			current = importRound{}
+		}
+		if m.Role == roleUser {
+			hasUser = true
+		}
+		current.Messages = append(current.Messages, m)
+	}
+	if len(current.Messages) > 0 {
+		rounds = append(rounds, current)
+	}
+
+	return rounds
+}
+
+// parseImportData 解析导出格式或OpenAI格式的消息数组
+func parseImportData(raw []byte) (importData, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return importData{}, fmt.Errorf("%w: 文件为空", errImportInvalid)
+	}
+
+	if raw[0] == '[' {
+		messages := []importMessage{}
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return importData{}, fmt.Errorf("%w: %s", errImportInvalid, err)
+		}
+		return importData{Rounds: splitIntoRounds(messages)}, nil
+	}
+
+	data := importData{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return importData{}, fmt.Errorf("%w: %s", errImportInvalid, err)
+	}
+	return data, nil
+}
+
+// ImportUser 从r中读取导出格式或OpenAI格式的消息数组, 将其作为用户的对话历史和记忆写入
+func (a *Atri) ImportUser(ctx context.Context, userID int64, r io.Reader) (ImportResult, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, maxImportSize+1))
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if len(raw) > maxImportSize {
+		return ImportResult{}, fmt.Errorf("%w: 文件太大", errImportInvalid)
+	}
+
+	data, err := parseImportData(raw)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	// 先全部校验, 再写入
+	rounds := []RoundRecord{}
+	for i, round := range data.Rounds {
+		record := RoundRecord{
+			UserID:           userID,
+			ModelName:        round.Model,
+			PromptTokens:     round.PromptTokens,
+			CompletionTokens: round.CompletionTokens,
+		}
+		// 对话按创建时间排序, 导入的对话保留原来的时间, 不会排在已有的对话之后; 没有时间的对话视为现在创建
+		if round.CreatedAt.Before(time.Now()) {
+			record.CreatedAt = round.CreatedAt
+		}
+
+		for j, m := range round.Messages {
+			// 系统消息(例如导出数据中每轮的当前时间)不导入, 避免通过导入注入系统提示词
+			if m.Role == roleSystem || m.Role == roleDeveloper {
+				continue
+			}
+
+			msg, err := m.toRecord()
+			if err != nil {
+				return ImportResult{}, fmt.Errorf("第%d轮第%d条消息: %w", i+1, j+1, err)
+			}
+			msg.Seq = len(record.Messages)
+			msg.UserID = userID
+			msg.CreatedAt = record.CreatedAt
+			record.Messages = append(record.Messages, msg)
+		}
+		if err := validateToolCalls(record.Messages); err != nil {
+			return ImportResult{}, fmt.Errorf("第%d轮: %w", i+1, err)
+		}
+
+		if len(record.Messages) > 0 {
+			rounds = append(rounds, record)
+		}
+	}
+
+	existingMemories, err := a.store.ListMemories(ctx, userID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	known := map[string]bool{}
+	for _, m := range existingMemories {
+		known[m.Memory] = true
+	}
+
+	result := ImportResult{}
+	for _, m := range data.Memories {
+		if m.Memory == "" || known[m.Memory] {
+			continue
+		}
+		if err := a.store.CreateMemory(ctx, userID, m.Memory); err != nil {
+			return result, err
+		}
+		known[m.Memory] = true
+		result.Memories++
+	}
+
+	for i := range rounds {
+		if err := a.store.CreateRound(ctx, &rounds[i]); err != nil {
+			return result, err
+		}
+		result.Rounds++
+	}
+
+	a.resetSession(userID)
+
+	a.logger.Info("导入对话历史完成",
+		zap.Int64("UserID", userID),
+		zap.Int("Rounds", result.Rounds),
+		zap.Int("Memories", result.Memories),
+	)
+
+	return result, nil
+}
+
+// resetSession 丢弃内存中的会话, 下次对话时会从数据库重新加载
+func (a *Atri) resetSession(userID int64) {
+	a.userSessionLock.Lock()
+	delete(a.userSession, userID)
+	a.updateSessionGauge()
+	a.userSessionLock.Unlock()
+}
+
+func (a *Atri) handleImport(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
+	session := a.getSessionOrInit(ctx, userID)
+
+	session.lock.Lock()
+	session.awaitingImport = true
+	session.lock.Unlock()
+
+	_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "import.prompt"), false)
+	return err
+}
+
+// handleDocument 处理用户发送的文件, 目前只用于导入对话历史
+func (a *Atri) handleDocument(ctx context.Context, bt *bot.Bot, message *models.Message) error {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+
+	session := a.getSessionOrInit(ctx, userID)
+
+	session.lock.Lock()
+	awaiting := session.awaitingImport
+	session.awaitingImport = false
+	session.lock.Unlock()
+
+	if !awaiting && !strings.HasPrefix(strings.TrimSpace(message.Caption), "/import") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "import.unexpected_file"), false)
+		return err
+	}
+
+	if message.Document.FileSize > maxImportSize {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "import.too_large"), false)
+		return err
+	}
+
+	raw, err := a.downloadFile(ctx, bt, message.Document.FileID)
+	if err != nil {
+		return err
+	}
+
+	result, err := a.ImportUser(ctx, userID, bytes.NewReader(raw))
+	if errors.Is(err, errImportInvalid) {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "import.failed", err), false)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "import.success", result.Rounds, result.Memories), false)
+	return err
+}
+
+// downloadFile 下载用户发送的文件
+func (a *Atri) downloadFile(ctx context.Context, bt *bot.Bot, fileID string) ([]byte, error) {
+	file, err := bt.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bt.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, stripURL(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, stripURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载文件失败: %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	return raw, stripURL(err)
+}
+
+// stripURL 去掉错误中的URL. 文件的下载链接包含Bot的Token, 错误可能会被发送给用户
+func stripURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("下载文件失败: %w", urlErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package atri
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateToolCalls(t *testing.T) {
+	user := MessageRecord{Role: roleUser, Content: "hi"}
+	call := func(ids string) MessageRecord {
+		return MessageRecord{Role: roleAssistant, ToolCalls: ids}
+	}
+	result := func(id string) MessageRecord {
+		return MessageRecord{Role: roleTool, ToolCallID: id, Content: "ok"}
+	}
+	reply := MessageRecord{Role: roleAssistant, Content: "done"}
+
+	tests := []struct {
+		name     string
+		messages []MessageRecord
+		wantErr  bool
+	}{
+		{"no tool calls", []MessageRecord{user, reply}, false},
+		{"paired", []MessageRecord{user, call(`[{"id":"a"}]`), result("a"), reply}, false},
+		{"parallel calls", []MessageRecord{user, call(`[{"id":"a"},{"id":"b"}]`), result("b"), result("a"), reply}, false},
+		{"two steps", []MessageRecord{user, call(`[{"id":"a"}]`), result("a"), call(`[{"id":"b"}]`), result("b"), reply}, false},
+		{"orphan result", []MessageRecord{user, result("a"), reply}, true},
+		{"result for another call", []MessageRecord{user, call(`[{"id":"a"}]`), result("b"), reply}, true},
+		{"duplicate result", []MessageRecord{user, call(`[{"id":"a"}]`), result("a"), result("a"), reply}, true},
+		{"missing result before reply", []MessageRecord{user, call(`[{"id":"a"},{"id":"b"}]`), result("a"), reply}, true},
+		{"missing result at end", []MessageRecord{user, call(`[{"id":"a"}]`)}, true},
+		{"call without id", []MessageRecord{user, call(`[{"type":"function"}]`), reply}, true},
+		{"malformed tool_calls", []MessageRecord{user, call(`{`), reply}, true},
+	}
+	for _, tt := range tests {
+		err := validateToolCalls(tt.messages)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateToolCalls() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errImportInvalid) {
+			t.Errorf("%s: error %v is not errImportInvalid", tt.name, err)
+		}
+	}
+}
+
+func TestSplitIntoRounds(t *testing.T) {
+	tests := []struct {
+		roles []string
+		want  []int // 每一轮的消息数
+	}{
+		{nil, []int{}},
+		{[]string{roleUser, roleAssistant}, []int{2}},
+		{[]string{roleUser, roleAssistant, roleUser, roleAssistant, roleTool, roleAssistant}, []int{2, 4}},
+		{[]string{roleSystem, roleUser, roleAssistant, roleUser}, []int{3, 1}},
+		{[]string{roleAssistant, roleAssistant}, []int{2}},
+	}
+	for _, tt := range tests {
+		messages := []importMessage{}
+		for _, role := range tt.roles {
+			messages = append(messages, importMessage{Role: role})
+		}
+
+		rounds := splitIntoRounds(messages)
+		got := []int{}
+		for _, r := range rounds {
+			got = append(got, len(r.Messages))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("splitIntoRounds(%v) = %v, want %v", tt.roles, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitIntoRounds(%v) = %v, want %v", tt.roles, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseImportData(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		rounds   int
+		memories int
+		wantErr  bool
+	}{
+		{"empty", "  \n", 0, 0, true},
+		{"malformed", "{", 0, 0, true},
+		{"export format", `{"memories":[{"memory":"m"}],"rounds":[{"messages":[{"role":"user","content":"hi"}]}]}`, 1, 1, false},
+		{"openai format", `[{"role":"user","content":"hi"},{"role":"assistant","content":"yo"},{"role":"user","content":"again"}]`, 2, 0, false},
+		{
+			"openai format with tool calls",
+			`[{"role":"user","content":"hi"},
+			  {"role":"assistant","content":null,"tool_calls":[{"id":"a","type":"function","function":{"name":"f","arguments":"{}"}}]},
+			  {"role":"tool","tool_call_id":"a","content":"ok"},
+			  {"role":"assistant","content":"done"}]`,
+			1, 0, false,
+		},
+	}
+	for _, tt := range tests {
+		data, err := parseImportData([]byte(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseImportData() = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(data.Rounds) != tt.rounds || len(data.Memories) != tt.memories {
+			t.Errorf("%s: parseImportData() has %d rounds and %d memories, want %d and %d",
+				tt.name, len(data.Rounds), len(data.Memories), tt.rounds, tt.memories)
+		}
+	}
+
+	// 解析后的工具调用可以通过校验
+	data, err := parseImportData([]byte(tests[len(tests)-1].raw))
+	check(t, err)
+	records := []MessageRecord{}
+	for _, m := range data.Rounds[0].Messages {
+		records = append(records, must[MessageRecord](t)(m.toRecord()))
+	}
+	check(t, validateToolCalls(records))
+}
@@ -0,0 +1,168 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+func (a *Atri) handleInvite(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if !a.requirePermission(ctx, userID, PermManageInvites, "invite") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
+		return err
+	}
+
+	if len(args) == 0 {
+		return a.handleInviteList(ctx, bt, chatID, userID, args)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "create", "new":
+		return a.handleInviteCreate(ctx, bt, chatID, userID, args[1:])
+	case "ls", "list":
+		return a.handleInviteList(ctx, bt, chatID, userID, args[1:])
+	case "revoke", "rm":
+		return a.handleInviteRevoke(ctx, bt, chatID, userID, args[1:])
+	default:
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.unknown_subcommand"), false)
+		return err
+	}
+}
+
+// handleInviteCreate 创建邀请码, 参数顺序不限: 数字为可用次数, 时长为有效期, admin表示管理员邀请
+func (a *Atri) handleInviteCreate(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	invite := &InviteRecord{
+		Code:      randomToken(8),
+		CreatedBy: userID,
+		MaxUses:   1,
+	}
+
+	for _, arg := range args {
+		if strings.ToLower(arg) == "admin" {
+			invite.IsAdmin = true
+			continue
+		}
+
+		if uses, err := strconv.Atoi(arg); err == nil {
+			if uses <= 0 {
+				_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.invalid_uses"), false)
+				return err
+			}
+			invite.MaxUses = uses
+			continue
+		}
+
+		d, err := parseDuration(arg)
+		if err != nil {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.create.usage"), false)
+			return err
+		}
+		expiresAt := time.Now().Add(d)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if invite.IsAdmin && !a.canGrantRole(ctx, userID, RoleAdmin) {
+		a.audit(ctx, userID, "invite.create", 0, strings.Join(args, " "), AuditDenied)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.above_self"), false)
+		return err
+	}
+
+	err := a.store.CreateInvite(ctx, invite)
+	a.audit(ctx, userID, "invite.create", 0, strings.Join(args, " "), auditOutcome(err))
+	if err != nil {
+		return err
+	}
+
+	a.logger.Info("创建了邀请码",
+		zap.Int64("UserID", userID),
+		zap.Int("MaxUses", invite.MaxUses),
+		zap.Bool("IsAdmin", invite.IsAdmin),
+	)
+
+	var sb strings.Builder
+	sb.WriteString(a.t(ctx, "invite.create.success", invite.Code))
+	if me, err := bt.GetMe(ctx); err == nil && me.Username != "" {
+		sb.WriteString(a.t(ctx, "invite.create.link", me.Username, invite.Code))
+	}
+	sb.WriteString(a.t(ctx, "invite.create.start", invite.Code))
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, sb.String(), false)
+	return err
+}
+
+func (a *Atri) handleInviteList(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, _ []string) error {
+	invites, err := a.store.ListInvites(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var sb strings.Builder
+	for _, i := range invites {
+		if !i.IsUsable(now) {
+			continue
+		}
+
+		role := "User"
+		if i.IsAdmin {
+			role = "Admin"
+		}
+		expires := a.t(ctx, "invite.forever")
+		if i.ExpiresAt != nil {
+			expires = i.ExpiresAt.Format(time.DateTime)
+		}
+		sb.WriteString(a.t(ctx, "invite.list.item", i.Code, role, i.Uses, i.MaxUses, expires))
+	}
+
+	if sb.Len() == 0 {
+		sb.WriteString(a.t(ctx, "invite.list.empty"))
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.list", sb.String()), false)
+	return err
+}
+
+func (a *Atri) handleInviteRevoke(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) < 1 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.revoke.missing_code"), false)
+		return err
+	}
+
+	err := a.store.RevokeInvite(ctx, args[0])
+	a.audit(ctx, userID, "invite.revoke", 0, args[0], auditOutcome(err))
+	if err != nil {
+		_, sendErr := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.revoke.failed"), false)
+		return sendErr
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.revoke.success"), false)
+	return err
+}
+
+// handleInviteRedeem 处理 /start <code> 形式的邀请码兑换
+func (a *Atri) handleInviteRedeem(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, username string, code string) {
+	invite, err := a.store.RedeemInvite(ctx, code, userID, time.Now())
+	if errors.Is(err, ErrInviteUnusable) {
+		a.audit(ctx, userID, "invite.redeem", userID, "", AuditDenied)
+		a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.redeem.invalid"), false)
+		return
+	}
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+
+	a.audit(ctx, userID, "invite.redeem", userID, strconv.FormatBool(invite.IsAdmin), AuditSuccess)
+	a.logger.Info("用户通过邀请码加入",
+		zap.Int64("UserID", userID),
+		zap.String("Username", username),
+		zap.Bool("IsAdmin", invite.IsAdmin),
+	)
+
+	a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "invite.redeem.success", username), false)
+}
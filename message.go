@@ -0,0 +1,160 @@
+package atri
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// 消息的角色
+const (
+	roleSystem    = "system"
+	roleDeveloper = "developer"
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	roleTool      = "tool"
+)
+
+// messageText 取出消息中的文本内容, 多段内容会拼接在一起
+func messageText(msg openai.ChatCompletionMessageParamUnion) string {
+	switch content := msg.GetContent().AsAny().(type) {
+	case *string:
+		return *content
+	case *[]openai.ChatCompletionContentPartTextParam:
+		parts := []string{}
+		for _, p := range *content {
+			parts = append(parts, p.Text)
+		}
+		return strings.Join(parts, "\n")
+	case *[]openai.ChatCompletionContentPartUnionParam:
+		parts := []string{}
+		for _, p := range *content {
+			if p.OfText != nil {
+				parts = append(parts, p.OfText.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	case *[]openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion:
+		parts := []string{}
+		for _, p := range *content {
+			if p.OfText != nil {
+				parts = append(parts, p.OfText.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// messageRole 返回消息的角色, 不支持的消息类型返回空字符串
+func messageRole(msg openai.ChatCompletionMessageParamUnion) string {
+	switch {
+	case msg.OfSystem != nil:
+		return roleSystem
+	case msg.OfDeveloper != nil:
+		return roleDeveloper
+	case msg.OfUser != nil:
+		return roleUser
+	case msg.OfAssistant != nil:
+		return roleAssistant
+	case msg.OfTool != nil:
+		return roleTool
+	default:
+		return ""
+	}
+}
+
+// messageRecordFromParam 将一条消息转换为MessageRecord, 不会填充RoundID和UserID
+func messageRecordFromParam(msg openai.ChatCompletionMessageParamUnion) (MessageRecord, error) {
+	role := messageRole(msg)
+	if role == "" {
+		return MessageRecord{}, fmt.Errorf("不支持的消息类型")
+	}
+
+	record := MessageRecord{
+		Role:    role,
+		Content: messageText(msg),
+	}
+
+	if toolCallID := msg.GetToolCallID(); toolCallID != nil {
+		record.ToolCallID = *toolCallID
+	}
+
+	if toolCalls := msg.GetToolCalls(); len(toolCalls) > 0 {
+		toolCallsJSON, err := json.Marshal(toolCalls)
+		if err != nil {
+			return MessageRecord{}, err
+		}
+		record.ToolCalls = string(toolCallsJSON)
+	}
+
+	return record, nil
+}
+
+// toParam 将MessageRecord还原为一条消息
+func (m MessageRecord) toParam() (openai.ChatCompletionMessageParamUnion, error) {
+	switch m.Role {
+	case roleSystem:
+		return openai.SystemMessage(m.Content), nil
+	case roleDeveloper:
+		return openai.DeveloperMessage(m.Content), nil
+	case roleUser:
+		return openai.UserMessage(m.Content), nil
+	case roleTool:
+		return openai.ToolMessage(m.Content, m.ToolCallID), nil
+	case roleAssistant:
+		msg := openai.AssistantMessage(m.Content)
+		if m.ToolCalls != "" {
+			toolCalls := []openai.ChatCompletionMessageToolCallUnionParam{}
+			err := json.Unmarshal([]byte(m.ToolCalls), &toolCalls)
+			if err != nil {
+				return openai.ChatCompletionMessageParamUnion{}, err
+			}
+			msg.OfAssistant.ToolCalls = toolCalls
+		}
+		return msg, nil
+	default:
+		return openai.ChatCompletionMessageParamUnion{}, fmt.Errorf("未知的消息角色: %s", m.Role)
+	}
+}
+
+// roundToMessages 将一轮对话拆分为按顺序编号的MessageRecord
+func roundToMessages(round roundHistory) ([]MessageRecord, error) {
+	records := make([]MessageRecord, 0, len(round))
+	for i, msg := range round {
+		record, err := messageRecordFromParam(msg)
+		if err != nil {
+			return nil, err
+		}
+		record.Seq = i
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// history 还原这一轮对话的所有消息, 兼容尚未迁移的InJSON
+func (r RoundRecord) history() (roundHistory, error) {
+	if len(r.Messages) == 0 && r.InJSON != "" {
+		round := roundHistory{}
+		err := json.Unmarshal([]byte(r.InJSON), &round)
+		return round, err
+	}
+
+	messages := slices.Clone(r.Messages)
+	slices.SortFunc(messages, func(a, b MessageRecord) int { return cmp.Compare(a.Seq, b.Seq) })
+
+	round := make(roundHistory, 0, len(messages))
+	for _, m := range messages {
+		msg, err := m.toParam()
+		if err != nil {
+			return nil, err
+		}
+		round = append(round, msg)
+	}
+	return round, nil
+}
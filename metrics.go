@@ -0,0 +1,110 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// llmLatencyBuckets 是LLM耗时直方图的桶(秒)
+var llmLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60, 120}
+
+// metrics 是Atri的所有指标, 注册在独立的Registry上, 不会污染宿主程序的默认Registry
+type metrics struct {
+	registry *prometheus.Registry
+
+	updates        *prometheus.CounterVec
+	commands       *prometheus.CounterVec
+	llmFirstToken  *prometheus.HistogramVec
+	llmDuration    *prometheus.HistogramVec
+	tokens         *prometheus.CounterVec
+	toolCalls      *prometheus.CounterVec
+	errors         *prometheus.CounterVec
+	activeSessions prometheus.Gauge
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "atri_updates_total",
+			Help: "收到的Telegram更新数",
+		}, []string{"type"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "atri_commands_total",
+			Help: "执行的命令数",
+		}, []string{"command"}),
+		llmFirstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "atri_llm_time_to_first_token_seconds",
+			Help:    "LLM请求到收到第一个Token的耗时",
+			Buckets: llmLatencyBuckets,
+		}, []string{"model"}),
+		llmDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "atri_llm_request_duration_seconds",
+			Help:    "LLM请求的总耗时",
+			Buckets: llmLatencyBuckets,
+		}, []string{"model"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "atri_tokens_total",
+			Help: "消耗的Token数",
+		}, []string{"model", "kind"}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "atri_tool_calls_total",
+			Help: "工具调用次数",
+		}, []string{"name", "outcome"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "atri_errors_total",
+			Help: "发生的错误数",
+		}, []string{"type"}),
+		activeSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "atri_active_sessions",
+			Help: "内存中的用户会话数",
+		}),
+	}
+
+	m.registry.MustRegister(m.updates, m.commands, m.llmFirstToken, m.llmDuration, m.tokens, m.toolCalls, m.errors, m.activeSessions)
+	return m
+}
+
+// observeUsage 记录一次LLM请求消耗的Token
+func (m *metrics) observeUsage(model string, usage openai.CompletionUsage) {
+	m.tokens.WithLabelValues(model, "prompt").Add(float64(usage.PromptTokens))
+	m.tokens.WithLabelValues(model, "completion").Add(float64(usage.CompletionTokens))
+}
+
+// errorType 将错误归类为有限的几种类型, 避免标签基数过高
+func errorType(err error) string {
+	var apiErr *openai.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.As(err, &apiErr):
+		return "openai"
+	default:
+		return "internal"
+	}
+}
+
+// MetricsHandler 返回以Prometheus格式输出指标的http.Handler, 可由宿主程序挂载到任意路径
+func (a *Atri) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// updateSessionGauge 更新会话数指标, 调用前需要持有userSessionLock
+func (a *Atri) updateSessionGauge() {
+	a.metrics.activeSessions.Set(float64(len(a.userSession)))
+}
+
+// sinceSeconds 返回从start到现在经过的秒数
+func sinceSeconds(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
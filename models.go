@@ -1,28 +1,197 @@
 package atri
 
-import "gorm.io/gorm"
+import (
+	"time"
 
-type memoryRecord struct {
-	gorm.Model
+	"gorm.io/gorm"
+)
+
+// Model 是所有记录共有的字段, 列与gorm.Model相同, 已有的数据库无需迁移.
+// DeletedAt沿用gorm.DeletedAt, 以保留GormStore的软删除, 其他Store实现可以忽略该字段
+type Model struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// MemoryRecord 是模型为用户存储的一条记忆
+type MemoryRecord struct {
+	Model
 
 	UserID int64
 	Memory string
 }
 
-func (m memoryRecord) String() string {
+func (m MemoryRecord) String() string {
 	return m.Memory
 }
 
-type allowedUserRecord struct {
-	gorm.Model
+// AllowedUserRecord 是白名单中的一个用户
+type AllowedUserRecord struct {
+	Model
 
 	UserID  int64
 	IsAdmin bool
+	Role    string // 为空时按IsAdmin视为admin或user
 }
 
-type roundRecord struct {
-	gorm.Model
+// RoundRecord 是一轮对话, 其中的消息保存在Messages中
+type RoundRecord struct {
+	Model
 
-	UserID int64
-	InJSON string
+	UserID           int64
+	MessageID        int    // 触发该轮对话的用户消息ID
+	InJSON           string // 已废弃, 仅保留旧版本整轮序列化的数据, 迁移后为空
+	ModelName        string
+	PromptTokens     int64
+	CompletionTokens int64
+	Messages         []MessageRecord `gorm:"foreignKey:RoundID"`
+}
+
+// MessageRecord 是一轮对话中的一条消息
+type MessageRecord struct {
+	Model
+
+	RoundID          uint  `gorm:"index"`
+	UserID           int64 `gorm:"index"`
+	Seq              int   // 在该轮中的顺序
+	Role             string
+	Content          string
+	ToolCalls        string // 助手消息发起的工具调用, JSON序列化
+	ToolCallID       string // 工具消息对应的工具调用ID
+	PromptTokens     int64  // 生成该条助手消息时的输入Token数
+	CompletionTokens int64  // 生成该条助手消息时的输出Token数
+}
+
+// UsageRecord 是按用户/日期/模型聚合的用量
+type UsageRecord struct {
+	Model
+
+	UserID           int64  `gorm:"uniqueIndex:idx_usage_user_day_model"`
+	Day              string `gorm:"uniqueIndex:idx_usage_user_day_model"`
+	ModelName        string `gorm:"uniqueIndex:idx_usage_user_day_model"`
+	Rounds           int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+// UserQuotaRecord 是管理员为某个用户设置的额度覆盖, 为nil的字段使用默认额度
+type UserQuotaRecord struct {
+	Model
+
+	UserID            int64 `gorm:"uniqueIndex"`
+	MessagesPerMinute *int
+	TokensPerDay      *int64
+	CostPerMonth      *float64
+}
+
+// UserSettingsRecord 是用户的个人设置, 为空的字段使用默认值
+type UserSettingsRecord struct {
+	Model
+
+	UserID   int64  `gorm:"uniqueIndex"`
+	Timezone string // IANA时区名, 如Asia/Shanghai
+	Language string
+}
+
+// InviteRecord 是一个邀请码
+type InviteRecord struct {
+	Model
+
+	Code      string `gorm:"uniqueIndex"`
+	CreatedBy int64
+	MaxUses   int
+	Uses      int
+	ExpiresAt *time.Time
+	IsAdmin   bool
+	Revoked   bool
+}
+
+// IsUsable 判断邀请码当前是否可以使用
+func (i InviteRecord) IsUsable(now time.Time) bool {
+	if i.Revoked || i.Uses >= i.MaxUses {
+		return false
+	}
+	return i.ExpiresAt == nil || now.Before(*i.ExpiresAt)
+}
+
+// 访问申请的状态
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// AccessRequestRecord 是非白名单用户提交的访问申请
+type AccessRequestRecord struct {
+	Model
+
+	UserID    int64 `gorm:"index"`
+	ChatID    int64
+	Username  string
+	Status    string
+	DecidedBy int64
+}
+
+// BanRecord 是一条封禁记录, 解除封禁时删除该记录
+type BanRecord struct {
+	Model
+
+	UserID    int64 `gorm:"index"`
+	BannedBy  int64
+	Reason    string
+	ExpiresAt *time.Time // 为nil时表示永久封禁
+}
+
+// IsActive 判断封禁当前是否有效
+func (b BanRecord) IsActive(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
+
+// 提醒的重复方式
+const (
+	RecurrenceNone    = ""
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// ReminderRecord 是一条提醒, 到期后发送到用户的私聊; 不重复的提醒发送后即删除
+type ReminderRecord struct {
+	Model
+
+	UserID     int64 `gorm:"index"`
+	Text       string
+	NextAt     time.Time `gorm:"index"` // 下一次提醒的时间
+	Recurrence string
+}
+
+// ScheduleRecord 是一条定时提示词, 按Spec(cron表达式)定时以Prompt发起一轮对话
+type ScheduleRecord struct {
+	Model
+
+	UserID int64 `gorm:"index"`
+	Spec   string
+	Prompt string
+	NextAt time.Time `gorm:"index"` // 下一次执行的时间
+}
+
+// 审计日志的结果
+const (
+	AuditSuccess = "success"
+	AuditFailed  = "failed"
+	AuditDenied  = "denied"
+)
+
+// AuditRecord 是一条管理操作或安全相关事件的审计日志, 时间即CreatedAt
+type AuditRecord struct {
+	Model
+
+	ActorID  int64  `gorm:"index"` // 执行操作的用户
+	Action   string `gorm:"index"`
+	TargetID int64  // 操作对象的用户ID, 没有时为0
+	Args     string
+	Outcome  string
 }
@@ -0,0 +1,133 @@
+package atri
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/openai/openai-go/v3"
+)
+
+// legacyPromptPlaceholders 是旧版本的占位符及其对应的模板, 旧的提示词无需修改即可继续使用
+var legacyPromptPlaceholders = strings.NewReplacer(
+	"{{USERNAME}}", "{{.User.Username}}",
+	"{{MEMORIES}}", "{{.MemoriesText}}",
+)
+
+// promptFuncs 是系统提示词模板中可以使用的函数
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+	// formatTime 按Go的时间格式格式化时间, 如 {{formatTime .Now "2006-01-02"}}
+	"formatTime": func(t time.Time, layout string) string { return t.Format(layout) },
+}
+
+// PromptUser 是系统提示词模板中的当前用户
+type PromptUser struct {
+	ID       int64
+	Username string
+	Role     string
+	Language string
+}
+
+// PromptMemory 是系统提示词模板中的一条记忆
+type PromptMemory struct {
+	ID        uint
+	Content   string
+	CreatedAt time.Time
+}
+
+// PromptData 是渲染系统提示词模板时的数据, 例如 {{.User.Username}}、{{range .Memories}}{{.Content}}{{end}}
+type PromptData struct {
+	User     PromptUser
+	Memories []PromptMemory
+	Now      time.Time // 用户时区的当前时间
+	Timezone string
+	Persona  string         // Config.Persona
+	ChatType string         // private/group/supergroup/channel
+	Vars     map[string]any // Config.PromptVars, 引用不存在的变量会报错
+}
+
+// MemoriesText 返回按行拼接的所有记忆, 与旧版本的{{MEMORIES}}相同
+func (d PromptData) MemoriesText() string {
+	memories := make([]string, 0, len(d.Memories))
+	for _, m := range d.Memories {
+		memories = append(memories, m.Content)
+	}
+	return strings.Join(memories, "\n")
+}
+
+// parseSystemPrompt 将系统提示词解析为text/template模板
+func parseSystemPrompt(prompt string) (*template.Template, error) {
+	return template.New("system_prompt").
+		Funcs(promptFuncs).
+		Option("missingkey=error").
+		Parse(legacyPromptPlaceholders.Replace(prompt))
+}
+
+// setupSystemPrompt 解析系统提示词模板, 并使用示例数据渲染一次, 以便在启动时发现模板中的错误
+func (a *Atri) setupSystemPrompt() error {
+	tmpl, err := parseSystemPrompt(a.config.SystemPrompt)
+	if err != nil {
+		return fmt.Errorf("解析系统提示词失败: %w", err)
+	}
+
+	sample := PromptData{
+		User:     PromptUser{ID: 1, Username: "user", Role: RoleUser, Language: a.defaultLanguage()},
+		Memories: []PromptMemory{{ID: 1, Content: "memory", CreatedAt: time.Now()}},
+		Now:      time.Now(),
+		Timezone: time.Local.String(),
+		Persona:  a.config.Persona,
+		ChatType: string(models.ChatTypePrivate),
+		Vars:     a.config.PromptVars,
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return fmt.Errorf("渲染系统提示词失败: %w", err)
+	}
+
+	a.systemPrompt = tmpl
+	return nil
+}
+
+// buildSystemPromptMessage 使用系统提示词模板构建系统提示词消息
+func (a *Atri) buildSystemPromptMessage(ctx context.Context, userID int64, username string, chatType models.ChatType) (openai.ChatCompletionMessageParamUnion, error) {
+	memoryRecords, err := a.store.ListMemories(ctx, userID)
+	if err != nil {
+		return openai.ChatCompletionMessageParamUnion{}, err
+	}
+	memories := []PromptMemory{}
+	for _, record := range memoryRecords {
+		memories = append(memories, PromptMemory{ID: record.ID, Content: record.String(), CreatedAt: record.CreatedAt})
+	}
+
+	role := ""
+	if user, err := a.store.GetUser(ctx, userID); err == nil {
+		role = user.effectiveRole()
+	}
+
+	language, ok := ctx.Value(languageKey{}).(string)
+	if !ok {
+		language = a.resolveLanguage(ctx, userID, "")
+	}
+
+	loc := a.userLocation(ctx, userID)
+	data := PromptData{
+		User:     PromptUser{ID: userID, Username: username, Role: role, Language: language},
+		Memories: memories,
+		Now:      time.Now().In(loc),
+		Timezone: loc.String(),
+		Persona:  a.config.Persona,
+		ChatType: string(chatType),
+		Vars:     a.config.PromptVars,
+	}
+
+	var sb strings.Builder
+	if err := a.systemPrompt.Execute(&sb, data); err != nil {
+		return openai.ChatCompletionMessageParamUnion{}, err
+	}
+
+	return openai.SystemMessage(sb.String()), nil
+}
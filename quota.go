@@ -0,0 +1,232 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// Quota 是用户的使用额度, 各项为0表示不限制
+type Quota struct {
+	MessagesPerMinute int
+	TokensPerDay      int64
+	CostPerMonth      float64
+}
+
+// rateLimiter 是按用户统计的滑动窗口限流器
+type rateLimiter struct {
+	lock sync.Mutex
+	hits map[int64][]time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{hits: make(map[int64][]time.Time)}
+}
+
+// allow 判断用户在窗口内是否还能再请求一次, 允许时会记录这一次请求; 拒绝时返回需要等待的时间
+func (r *rateLimiter) allow(userID int64, limit int, window time.Duration) (bool, time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	hits := r.hits[userID]
+
+	// 丢弃窗口外的记录
+	start := 0
+	for start < len(hits) && now.Sub(hits[start]) >= window {
+		start++
+	}
+	hits = hits[start:]
+
+	if len(hits) >= limit {
+		r.hits[userID] = hits
+		return false, window - now.Sub(hits[0])
+	}
+
+	r.hits[userID] = append(hits, now)
+	return true, 0
+}
+
+// effectiveQuota 获取用户实际生效的额度
+func (a *Atri) effectiveQuota(ctx context.Context, userID int64) (Quota, error) {
+	quota := a.config.DefaultQuota
+
+	record, err := a.store.GetUserQuota(ctx, userID)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	if record.MessagesPerMinute != nil {
+		quota.MessagesPerMinute = *record.MessagesPerMinute
+	}
+	if record.TokensPerDay != nil {
+		quota.TokensPerDay = *record.TokensPerDay
+	}
+	if record.CostPerMonth != nil {
+		quota.CostPerMonth = *record.CostPerMonth
+	}
+
+	return quota, nil
+}
+
+// checkQuota 检查用户是否还能发起对话, 超出额度时返回给用户的提示
+func (a *Atri) checkQuota(ctx context.Context, userID int64) (string, error) {
+	quota, err := a.effectiveQuota(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	if quota.TokensPerDay > 0 {
+		today, err := a.summarizeUsageSince(ctx, userID, now)
+		if err != nil {
+			return "", err
+		}
+		if today.PromptTokens+today.CompletionTokens >= quota.TokensPerDay {
+			return a.t(ctx, "quota.tokens_exhausted", quota.TokensPerDay), nil
+		}
+	}
+
+	if quota.CostPerMonth > 0 {
+		month, err := a.summarizeUsageSince(ctx, userID, now.AddDate(0, 0, 1-now.Day()))
+		if err != nil {
+			return "", err
+		}
+		if month.Cost >= quota.CostPerMonth {
+			return a.t(ctx, "quota.cost_exhausted", quota.CostPerMonth), nil
+		}
+	}
+
+	if quota.MessagesPerMinute > 0 {
+		ok, wait := a.messageLimiter.allow(userID, quota.MessagesPerMinute, time.Minute)
+		if !ok {
+			return a.t(ctx, "quota.rate_limited", int(wait.Seconds())+1), nil
+		}
+	}
+
+	return "", nil
+}
+
+// describeQuota 以当前用户的语言描述额度
+func (a *Atri) describeQuota(ctx context.Context, q Quota) string {
+	rpm := a.t(ctx, "info.unlimited")
+	if q.MessagesPerMinute > 0 {
+		rpm = strconv.Itoa(q.MessagesPerMinute)
+	}
+	tokens := a.t(ctx, "info.unlimited")
+	if q.TokensPerDay > 0 {
+		tokens = strconv.FormatInt(q.TokensPerDay, 10)
+	}
+	cost := a.t(ctx, "info.unlimited")
+	if q.CostPerMonth > 0 {
+		cost = fmt.Sprintf("%.2f", q.CostPerMonth)
+	}
+
+	return a.t(ctx, "quota.description", rpm, tokens, cost)
+}
+
+func (a *Atri) handleQuota(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) >= 1 && strings.ToLower(args[0]) == "set" {
+		return a.handleQuotaSet(ctx, bt, chatID, userID, args[1:])
+	}
+
+	targetID := userID
+	if len(args) >= 1 {
+		if !a.requirePermission(ctx, userID, PermManageQuota, "quota.view") {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.no_permission_view"), false)
+			return err
+		}
+
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
+			return err
+		}
+		targetID = id
+	}
+
+	quota, err := a.effectiveQuota(ctx, targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.show", targetID, a.describeQuota(ctx, quota)), false)
+	return err
+}
+
+func (a *Atri) handleQuotaSet(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if !a.requirePermission(ctx, userID, PermManageQuota, "quota.set") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
+		return err
+	}
+
+	if len(args) < 3 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.set.usage"), false)
+		return err
+	}
+
+	targetID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
+		return err
+	}
+
+	record, err := a.store.GetUserQuota(ctx, targetID)
+	if err != nil {
+		return err
+	}
+
+	valueStr := strings.ToLower(args[2])
+	useDefault := valueStr == "default"
+
+	switch strings.ToLower(args[1]) {
+	case "rpm":
+		record.MessagesPerMinute = nil
+		if !useDefault {
+			v, err := strconv.Atoi(valueStr)
+			if err != nil || v < 0 {
+				_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.invalid_integer"), false)
+				return err
+			}
+			record.MessagesPerMinute = &v
+		}
+	case "tokens":
+		record.TokensPerDay = nil
+		if !useDefault {
+			v, err := strconv.ParseInt(valueStr, 10, 64)
+			if err != nil || v < 0 {
+				_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.invalid_integer"), false)
+				return err
+			}
+			record.TokensPerDay = &v
+		}
+	case "cost":
+		record.CostPerMonth = nil
+		if !useDefault {
+			v, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil || v < 0 {
+				_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.invalid_number"), false)
+				return err
+			}
+			record.CostPerMonth = &v
+		}
+	default:
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.unknown_item"), false)
+		return err
+	}
+
+	err = a.store.SaveUserQuota(ctx, &record)
+	a.audit(ctx, userID, "quota.set", targetID, strings.Join(args[1:], " "), auditOutcome(err))
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "quota.set.success"), false)
+	return err
+}
@@ -0,0 +1,55 @@
+package atri
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	const window = time.Minute
+	tests := []struct {
+		name     string
+		ages     []time.Duration // 已有请求距现在的时间, 从旧到新
+		limit    int
+		want     bool
+		wantWait time.Duration // 拒绝时大约需要等待的时间
+		wantHits int
+	}{
+		{"empty", nil, 2, true, 0, 1},
+		{"under limit", []time.Duration{30 * time.Second}, 2, true, 0, 2},
+		{"at limit", []time.Duration{50 * time.Second, 10 * time.Second}, 2, false, 10 * time.Second, 2},
+		{"oldest slid out", []time.Duration{70 * time.Second, 10 * time.Second}, 2, true, 0, 2},
+		{"exactly one window old", []time.Duration{window, 10 * time.Second}, 2, true, 0, 2},
+		{"all slid out", []time.Duration{3 * window, 2 * window}, 1, true, 0, 1},
+	}
+	for _, tt := range tests {
+		r := newRateLimiter()
+		now := time.Now()
+		for _, age := range tt.ages {
+			r.hits[1] = append(r.hits[1], now.Add(-age))
+		}
+
+		ok, wait := r.allow(1, tt.limit, window)
+		if ok != tt.want {
+			t.Errorf("%s: allow() = %v, want %v", tt.name, ok, tt.want)
+		}
+		if wait > tt.wantWait || wait < tt.wantWait-time.Second {
+			t.Errorf("%s: allow() wait = %v, want about %v", tt.name, wait, tt.wantWait)
+		}
+		if len(r.hits[1]) != tt.wantHits {
+			t.Errorf("%s: %d hits recorded, want %d", tt.name, len(r.hits[1]), tt.wantHits)
+		}
+	}
+
+	// 不同用户的窗口互不影响
+	r := newRateLimiter()
+	if ok, _ := r.allow(1, 1, window); !ok {
+		t.Fatal("first request was rejected")
+	}
+	if ok, _ := r.allow(1, 1, window); ok {
+		t.Fatal("second request within the window was allowed")
+	}
+	if ok, _ := r.allow(2, 1, window); !ok {
+		t.Fatal("another user was limited")
+	}
+}
@@ -0,0 +1,261 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/openai/openai-go/v3"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+// reminderCheckInterval 是检查到期提醒的间隔
+const reminderCheckInterval = 30 * time.Second
+
+// reminderTimeLayouts 是create_reminder工具接受的时间格式, 不带时区的时间按用户的时区解析
+var reminderTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// reminderRecurrences 是所有可用的重复方式
+var reminderRecurrences = []string{RecurrenceNone, RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly}
+
+// parseReminderTime 按reminderTimeLayouts解析时间
+func parseReminderTime(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range reminderTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q", s)
+}
+
+// nextOccurrence 返回重复提醒在now之后的下一次时间, 不重复时返回零值.
+// 每月重复时, 下个月没有这一天则取当月最后一天(例如1月31日之后是2月28日)
+func nextOccurrence(at time.Time, recurrence string, now time.Time) time.Time {
+	// nth 返回at之后的第n次时间, 每次都从at计算, 补发时不会逐月累积偏移
+	nth := func(n int) time.Time {
+		switch recurrence {
+		case RecurrenceDaily:
+			return at.AddDate(0, 0, n)
+		case RecurrenceWeekly:
+			return at.AddDate(0, 0, 7*n)
+		case RecurrenceMonthly:
+			t := at.AddDate(0, n, 0)
+			if t.Day() != at.Day() {
+				// 日期溢出到了下个月, 退回到上个月的最后一天
+				t = t.AddDate(0, 0, -t.Day())
+			}
+			return t
+		}
+		return time.Time{}
+	}
+
+	// 停机期间错过的提醒只补发一次
+	for n := 1; ; n++ {
+		t := nth(n)
+		if t.IsZero() || t.After(now) {
+			return t
+		}
+	}
+}
+
+// recurrenceName 返回重复方式的描述, 用于工具调用的结果
+func recurrenceName(recurrence string) string {
+	switch recurrence {
+	case RecurrenceDaily:
+		return "每天"
+	case RecurrenceWeekly:
+		return "每周"
+	case RecurrenceMonthly:
+		return "每月"
+	}
+	return "一次"
+}
+
+// recurrenceLabel 以当前用户的语言返回重复方式的描述
+func (a *Atri) recurrenceLabel(ctx context.Context, recurrence string) string {
+	switch recurrence {
+	case RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly:
+		return a.t(ctx, "recurrence."+recurrence)
+	}
+	return a.t(ctx, "recurrence.once")
+}
+
+// startReminderLoop 在后台定期发送到期的提醒, 直到a.ctx结束. 提醒保存在数据库中, 重启后会补发停机期间到期的提醒
+func (a *Atri) startReminderLoop() {
+	go func() {
+		ticker := time.NewTicker(reminderCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			a.deliverDueReminders(a.ctx)
+
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// deliverDueReminders 发送所有到期的提醒, 重复的提醒会被安排到下一次, 其余的提醒发送后删除.
+// 因临时错误发送失败的提醒保持不变, 下一次检查时重试; 用户屏蔽了Bot等无法恢复的错误按发送过处理. 不在白名单中或被封禁的用户不会收到提醒, 但到期的提醒照常安排下一次或删除
+func (a *Atri) deliverDueReminders(ctx context.Context) {
+	now := time.Now()
+	reminders, err := a.store.ListDueReminders(ctx, now)
+	if err != nil {
+		a.logger.Error("加载到期提醒失败", zap.Error(err))
+		return
+	}
+
+	for _, r := range reminders {
+		inBuck, err := a.hasUser(ctx, r.UserID)
+		if err != nil {
+			a.logger.Error("检查白名单失败", zap.Int64("UserID", r.UserID), zap.Error(err))
+			continue
+		}
+		ban, err := a.activeBan(ctx, r.UserID)
+		if err != nil {
+			a.logger.Error("检查封禁失败", zap.Int64("UserID", r.UserID), zap.Error(err))
+			continue
+		}
+
+		if inBuck && ban == nil {
+			// 私聊的ChatID与UserID相同
+			userCtx := withLanguage(ctx, a.resolveLanguage(ctx, r.UserID, ""))
+			_, err := a.sendMessageTo(ctx, a.bot, r.UserID, a.t(userCtx, "remind.notice", r.Text), false)
+			if err != nil {
+				a.logger.Error("发送提醒失败", zap.Int64("UserID", r.UserID), zap.Uint("ReminderID", r.ID), zap.Error(err))
+				if !isPermanentSendError(err) {
+					continue
+				}
+			}
+		}
+
+		// 在用户的时区中计算下一次时间, 夏令时切换时保持同一钟点
+		loc := a.userLocation(ctx, r.UserID)
+		if next := nextOccurrence(r.NextAt.In(loc), r.Recurrence, now); !next.IsZero() {
+			err = a.store.UpdateReminderNext(ctx, r.ID, next)
+		} else {
+			err = a.store.DeleteReminder(ctx, r.UserID, r.ID)
+		}
+		if err != nil {
+			a.logger.Error("更新提醒失败", zap.Uint("ReminderID", r.ID), zap.Error(err))
+		}
+	}
+}
+
+// handleCreateReminderTool 处理创建提醒工具
+func (a *Atri) handleCreateReminderTool(ctx context.Context, _ *bot.Bot, userID int64, callID string, callData string) openai.ChatCompletionMessageParamUnion {
+	timeArg, message, ok := a.assertAndGetToolArgument(callID, callData, "time", gjson.String)
+	if !ok {
+		return message
+	}
+	text, message, ok := a.assertAndGetToolArgument(callID, callData, "text", gjson.String)
+	if !ok {
+		return message
+	}
+
+	recurrence := strings.ToLower(gjson.Get(callData, "recurrence").String())
+	if recurrence == "none" {
+		recurrence = RecurrenceNone
+	}
+	if !slices.Contains(reminderRecurrences, recurrence) {
+		return openai.ToolMessage(fmt.Sprintf("错误: 不支持的重复方式\"%s\".", recurrence), callID)
+	}
+
+	loc := a.userLocation(ctx, userID)
+	at, err := parseReminderTime(timeArg.String(), loc)
+	if err != nil {
+		return openai.ToolMessage(fmt.Sprintf("错误: %s, 请使用\"2006-01-02 15:04\"格式.", err), callID)
+	}
+	if recurrence == RecurrenceNone && !at.After(time.Now()) {
+		return openai.ToolMessage("错误: 提醒时间必须晚于当前时间.", callID)
+	}
+
+	reminder := &ReminderRecord{
+		UserID:     userID,
+		Text:       text.String(),
+		NextAt:     at,
+		Recurrence: recurrence,
+	}
+	if !at.After(time.Now()) {
+		reminder.NextAt = nextOccurrence(at, recurrence, time.Now())
+	}
+
+	err = a.store.CreateReminder(ctx, reminder)
+	if err != nil {
+		a.logger.Error("创建提醒失败!", zap.Error(err))
+		return openai.ToolMessage(fmt.Sprintf("错误: 创建提醒失败. %s", err), callID)
+	}
+
+	return openai.ToolMessage(fmt.Sprintf("已创建提醒(ID %d), 将于%s提醒(%s).", reminder.ID, reminder.NextAt.In(loc).Format(time.DateTime), recurrenceName(recurrence)), callID)
+}
+
+func (a *Atri) handleRemind(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) == 0 {
+		return a.handleRemindList(ctx, bt, chatID, userID, args)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "ls", "list":
+		return a.handleRemindList(ctx, bt, chatID, userID, args[1:])
+	case "rm", "remove":
+		return a.handleRemindRemove(ctx, bt, chatID, userID, args[1:])
+	default:
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "remind.unknown_subcommand"), false)
+		return err
+	}
+}
+
+func (a *Atri) handleRemindList(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
+	reminders, err := a.store.ListReminders(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(reminders) == 0 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "remind.empty"), false)
+		return err
+	}
+
+	loc := a.userLocation(ctx, userID)
+	var sb strings.Builder
+	for _, r := range reminders {
+		fmt.Fprintf(&sb, "ID: %d - %s (%s)\n%s\n\n", r.ID, r.NextAt.In(loc).Format(time.DateTime), a.recurrenceLabel(ctx, r.Recurrence), r.Text)
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "remind.list", sb.String()), false)
+	return err
+}
+
+func (a *Atri) handleRemindRemove(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) < 1 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "remind.rm.missing_id"), false)
+		return err
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "id_not_number"), false)
+		return err
+	}
+
+	err = a.store.DeleteReminder(ctx, userID, uint(id))
+	if errors.Is(err, ErrNotFound) {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "remind.rm.not_found"), false)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "deleted"), false)
+	return err
+}
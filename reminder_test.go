@@ -0,0 +1,34 @@
+package atri
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	at := time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		recurrence string
+		now        time.Time
+		want       time.Time
+	}{
+		{"once", RecurrenceNone, at, time.Time{}},
+		{"daily on time", RecurrenceDaily, at, time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"daily missed three days", RecurrenceDaily, time.Date(2025, 2, 3, 12, 0, 0, 0, time.UTC), time.Date(2025, 2, 4, 9, 0, 0, 0, time.UTC)},
+		{"daily exactly at next", RecurrenceDaily, time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC), time.Date(2025, 2, 2, 9, 0, 0, 0, time.UTC)},
+		{"weekly missed two weeks", RecurrenceWeekly, time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 21, 9, 0, 0, 0, time.UTC)},
+		{"monthly clamps to the end of month", RecurrenceMonthly, at, time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC)},
+		{"monthly missed into march", RecurrenceMonthly, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 31, 9, 0, 0, 0, time.UTC)},
+		{"monthly missed a year", RecurrenceMonthly, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := nextOccurrence(at, tt.recurrence, tt.now)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: nextOccurrence() = %v, want %v", tt.name, got, tt.want)
+		}
+		if !got.IsZero() && !got.After(tt.now) {
+			t.Errorf("%s: nextOccurrence() = %v is not after now %v", tt.name, got, tt.now)
+		}
+	}
+}
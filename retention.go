@@ -0,0 +1,136 @@
+package atri
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// defaultPurgeInterval 是未配置PurgeInterval时清理任务的执行间隔
+const defaultPurgeInterval = time.Hour
+
+// Retention 是数据保留策略, 各字段为零值时表示永久保留
+type Retention struct {
+	MaxAge        time.Duration // 超过该时长的对话会被删除
+	MaxRounds     int           // 每个用户最多保留的对话轮数, 需不小于Config.MaxRounds
+	MemoryMaxAge  time.Duration // 超过该时长的记忆会被删除
+	AuditMaxAge   time.Duration // 超过该时长的审计日志会被删除
+	PurgeInterval time.Duration // 清理任务的执行间隔
+}
+
+// enabled 返回是否配置了任何保留条件
+func (r Retention) enabled() bool {
+	return r.MaxAge > 0 || r.MaxRounds > 0 || r.MemoryMaxAge > 0 || r.AuditMaxAge > 0
+}
+
+// startRetentionLoop 在后台定期按保留策略清理数据, 直到a.ctx结束
+func (a *Atri) startRetentionLoop() {
+	retention := a.config.Retention
+	if !retention.enabled() {
+		return
+	}
+
+	interval := retention.PurgeInterval
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			a.purgeExpiredData(a.ctx)
+
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeExpiredData 按保留策略执行一次清理
+func (a *Atri) purgeExpiredData(ctx context.Context) {
+	retention := a.config.Retention
+	now := time.Now()
+
+	var purged int64
+
+	if retention.MaxAge > 0 || retention.MaxRounds > 0 {
+		before := time.Time{}
+		if retention.MaxAge > 0 {
+			before = now.Add(-retention.MaxAge)
+		}
+
+		n, err := a.store.PurgeRounds(ctx, before, retention.MaxRounds)
+		if err != nil {
+			a.logger.Error("清理过期对话失败", zap.Error(err))
+		}
+		purged += n
+		if n > 0 {
+			a.logger.Info("清理了过期对话", zap.Int64("Rounds", n))
+		}
+	}
+
+	if retention.MemoryMaxAge > 0 {
+		n, err := a.store.PurgeMemories(ctx, now.Add(-retention.MemoryMaxAge))
+		if err != nil {
+			a.logger.Error("清理过期记忆失败", zap.Error(err))
+		}
+		if n > 0 {
+			a.logger.Info("清理了过期记忆", zap.Int64("Memories", n))
+		}
+	}
+
+	if retention.AuditMaxAge > 0 {
+		n, err := a.store.PurgeAudits(ctx, now.Add(-retention.AuditMaxAge))
+		if err != nil {
+			a.logger.Error("清理过期审计日志失败", zap.Error(err))
+		}
+		if n > 0 {
+			a.logger.Info("清理了过期审计日志", zap.Int64("Audits", n))
+		}
+	}
+
+	// 内存中的会话可能还持有被删除的对话, 丢弃后会从数据库重新加载
+	if purged > 0 {
+		a.userSessionLock.Lock()
+		clear(a.userSession)
+		a.updateSessionGauge()
+		a.userSessionLock.Unlock()
+	}
+}
+
+// forgetUser 删除用户的对话和记忆, 并丢弃内存中的会话
+func (a *Atri) forgetUser(ctx context.Context, userID int64) error {
+	if err := a.store.DeleteUserData(ctx, userID); err != nil {
+		return err
+	}
+	a.resetSession(userID)
+
+	a.logger.Info("删除了用户的数据", zap.Int64("UserID", userID))
+	return nil
+}
+
+func (a *Atri) handleForgetMe(ctx context.Context, bt *bot.Bot, chatID int64, _ int64, _ []string) error {
+	confirm := newCallbackData(callbackForgetMe)
+	_, err := a.sendMessageWithKeyboard(ctx, bt, chatID, a.t(ctx, "forgetme.confirm"), a.confirmKeyboard(ctx, confirm))
+	return err
+}
+
+func (a *Atri) handleForgetMeCallback(ctx context.Context, bt *bot.Bot, query *models.CallbackQuery, _ callbackData) (string, error) {
+	err := a.forgetUser(ctx, query.From.ID)
+	a.audit(ctx, query.From.ID, "user.forget", query.From.ID, "", auditOutcome(err))
+	if err != nil {
+		return "", err
+	}
+
+	msg := query.Message.Message
+	_, err = a.editMessageText(ctx, bt, msg.Chat.ID, msg.ID, a.t(ctx, "forgetme.done"), nil)
+	return "", err
+}
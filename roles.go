@@ -0,0 +1,172 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// Permission 是一项权限
+type Permission string
+
+// 内置的权限
+const (
+	PermAll           Permission = "*"              // 拥有所有权限
+	PermUseTools      Permission = "use_tools"      // 对话时可以使用工具
+	PermManageUsers   Permission = "manage_users"   // 管理白名单、角色和访问申请
+	PermManageInvites Permission = "manage_invites" // 管理邀请码
+	PermManageQuota   Permission = "manage_quota"   // 查看和设置其他用户的额度
+	PermViewUsage     Permission = "view_usage"     // 查看所有用户的用量
+	PermViewAudit     Permission = "view_audit"     // 查看审计日志
+	PermBroadcast     Permission = "broadcast"      // 向所有用户广播消息
+)
+
+// 内置的角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+	RoleGuest = "guest"
+)
+
+// defaultRoles 是内置角色的权限, 可以通过Config.Roles覆盖或添加新的角色
+var defaultRoles = map[string][]Permission{
+	RoleAdmin: {PermAll},
+	RoleUser:  {PermUseTools},
+	RoleGuest: {},
+}
+
+// effectiveRole 返回用户的角色, 没有设置角色的旧记录按IsAdmin推断
+func (u AllowedUserRecord) effectiveRole() string {
+	if u.Role != "" {
+		return u.Role
+	}
+	if u.IsAdmin {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+// roles 返回所有角色及其权限
+func (a *Atri) roles() map[string][]Permission {
+	roles := maps.Clone(defaultRoles)
+	maps.Copy(roles, a.config.Roles)
+	return roles
+}
+
+// roleHasPermission 判断角色是否拥有某项权限, 未知的角色没有任何权限
+func (a *Atri) roleHasPermission(role string, perm Permission) bool {
+	perms := a.roles()[role]
+	return slices.Contains(perms, PermAll) || slices.Contains(perms, perm)
+}
+
+// hasPermission 判断用户是否拥有某项权限, 不在白名单内的用户没有任何权限
+func (a *Atri) hasPermission(ctx context.Context, userID int64, perm Permission) bool {
+	user, err := a.store.GetUser(ctx, userID)
+	if err != nil {
+		return false
+	}
+	return a.roleHasPermission(user.effectiveRole(), perm)
+}
+
+// requirePermission 判断用户是否拥有某项权限, 没有时记录一条被拒绝的审计日志
+func (a *Atri) requirePermission(ctx context.Context, userID int64, perm Permission, action string) bool {
+	if a.hasPermission(ctx, userID, perm) {
+		return true
+	}
+
+	a.audit(ctx, userID, action, 0, string(perm), AuditDenied)
+	return false
+}
+
+// canGrantRole 判断用户能否授予某个角色: 角色的每一项权限用户自己都要拥有, 避免用户给自己或他人提权
+func (a *Atri) canGrantRole(ctx context.Context, userID int64, role string) bool {
+	for _, perm := range a.roles()[role] {
+		if !a.hasPermission(ctx, userID, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// canManageUser 判断用户能否降级、移除或封禁目标用户: 目标的权限不能多于用户自己. 不在白名单内的目标总是可以管理
+func (a *Atri) canManageUser(ctx context.Context, userID int64, targetID int64) bool {
+	target, err := a.store.GetUser(ctx, targetID)
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+	if err != nil {
+		a.logger.Error("加载用户失败", zap.Int64("UserID", targetID), zap.Error(err))
+		return false
+	}
+	return a.canGrantRole(ctx, userID, target.effectiveRole())
+}
+
+// handleUserRole 查看或设置用户的角色: /user role <ID> [角色]
+func (a *Atri) handleUserRole(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	roles := a.roles()
+	names := slices.Sorted(maps.Keys(roles))
+
+	if len(args) < 1 {
+		var sb strings.Builder
+		sb.WriteString(a.t(ctx, "role.usage"))
+		for _, name := range names {
+			perms := []string{}
+			for _, p := range roles[name] {
+				perms = append(perms, string(p))
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", name, strings.Join(perms, ", "))
+		}
+		_, err := a.sendMessageTo(ctx, bt, chatID, sb.String(), false)
+		return err
+	}
+
+	targetID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "user_id_not_number"), false)
+		return err
+	}
+
+	user, err := a.store.GetUser(ctx, targetID)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.user_not_found"), false)
+		return err
+	}
+
+	if len(args) < 2 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.show", targetID, user.effectiveRole()), false)
+		return err
+	}
+
+	role := strings.ToLower(args[1])
+	if _, ok := roles[role]; !ok {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.unknown", strings.Join(names, ", ")), false)
+		return err
+	}
+
+	if !a.canGrantRole(ctx, userID, role) || !a.canManageUser(ctx, userID, targetID) {
+		a.audit(ctx, userID, "user.role", targetID, role, AuditDenied)
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.above_self"), false)
+		return err
+	}
+
+	if targetID == userID && !a.roleHasPermission(role, PermManageUsers) {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.self"), false)
+		return err
+	}
+
+	err = a.store.UpdateUserRole(ctx, targetID, role)
+	a.audit(ctx, userID, "user.role", targetID, role, auditOutcome(err))
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "role.success"), false)
+	return err
+}
@@ -0,0 +1,59 @@
+package atri
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRoleEscalation(t *testing.T) {
+	ctx := context.Background()
+	a := &Atri{
+		store: NewMemoryStore(),
+		config: Config{Roles: map[string][]Permission{
+			"moderator": {PermUseTools, PermManageUsers},
+		}},
+	}
+	const admin, moderator, user, stranger = 1, 2, 3, 4
+	check(t, a.store.CreateUser(ctx, admin, true))
+	check(t, a.store.CreateUser(ctx, moderator, false))
+	check(t, a.store.UpdateUserRole(ctx, moderator, "moderator"))
+	check(t, a.store.CreateUser(ctx, user, false))
+
+	grants := []struct {
+		actor int64
+		role  string
+		want  bool
+	}{
+		{admin, RoleAdmin, true},
+		{admin, "moderator", true},
+		{moderator, RoleAdmin, false},
+		{moderator, "moderator", true},
+		{moderator, RoleUser, true},
+		{moderator, RoleGuest, true},
+		{user, "moderator", false},
+		{stranger, RoleGuest, true},
+		{stranger, RoleUser, false},
+	}
+	for _, tt := range grants {
+		if got := a.canGrantRole(ctx, tt.actor, tt.role); got != tt.want {
+			t.Errorf("canGrantRole(%d, %q) = %v, want %v", tt.actor, tt.role, got, tt.want)
+		}
+	}
+
+	manages := []struct {
+		actor, target int64
+		want          bool
+	}{
+		{admin, moderator, true},
+		{moderator, admin, false},
+		{moderator, moderator, true},
+		{moderator, user, true},
+		{moderator, stranger, true},
+		{user, moderator, false},
+	}
+	for _, tt := range manages {
+		if got := a.canManageUser(ctx, tt.actor, tt.target); got != tt.want {
+			t.Errorf("canManageUser(%d, %d) = %v, want %v", tt.actor, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// allowedUpdates 是Bot需要接收的更新类型
+var allowedUpdates = bot.AllowedUpdates{
+	models.AllowedUpdateMessage,
+	models.AllowedUpdateEditedMessage,
+	models.AllowedUpdateCallbackQuery,
+	models.AllowedUpdateMyChatMember,
+	models.AllowedUpdateInlineQuery,
+}
+
+// updateTypeOf 返回更新的类型, 用于指标和链路追踪
+func updateTypeOf(update *models.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	default:
+		return "other"
+	}
+}
+
+// handlerForUpdate 按更新类型分发所有更新
+func (a *Atri) handlerForUpdate(ctx context.Context, bt *bot.Bot, update *models.Update) {
+	updateType := updateTypeOf(update)
+	a.metrics.updates.WithLabelValues(updateType).Inc()
+
+	ctx, span := a.startSpan(ctx, "atri.update", append(updateAttributes(update), attribute.String("telegram.update_type", updateType))...)
+	defer span.End()
+
+	switch {
+	case update.Message != nil:
+		a.handlerForTextMessage(ctx, bt, update.Message)
+	case update.EditedMessage != nil:
+		a.handlerForEditedMessage(ctx, bt, update.EditedMessage)
+	case update.CallbackQuery != nil:
+		a.handlerForCallbackQuery(ctx, bt, update.CallbackQuery)
+	case update.MyChatMember != nil:
+		a.handlerForMyChatMember(ctx, bt, update.MyChatMember)
+	case update.InlineQuery != nil:
+		a.handlerForInlineQuery(ctx, bt, update.InlineQuery)
+	default:
+		a.logger.Debug("忽略不支持的更新", zap.Int64("UpdateID", update.ID))
+	}
+}
+
+// handlerForEditedMessage 用户修改了触发最新一轮对话的消息时, 用修改后的内容重新回答
+func (a *Atri) handlerForEditedMessage(ctx context.Context, bt *bot.Bot, message *models.Message) {
+	if message.From == nil {
+		return
+	}
+
+	chatID := message.Chat.ID
+	chatText := strings.TrimSpace(message.Text)
+	username := message.Chat.Username
+	userID := message.From.ID
+
+	if chatText == "" || strings.HasPrefix(chatText, "/") {
+		return
+	}
+
+	ctx = withLanguage(ctx, a.resolveLanguage(ctx, userID, message.From.LanguageCode))
+
+	inBuck, err := a.hasUser(ctx, userID)
+	if err != nil || !inBuck {
+		return
+	}
+	if a.checkBanned(ctx, bt, chatID, userID) {
+		return
+	}
+
+	last, err := a.store.GetLastRound(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return
+	}
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+	if last.MessageID != message.ID {
+		a.logger.Debug("修改的不是最新一轮的消息, 忽略", zap.Int64("UserID", userID), zap.Int("MessageID", message.ID))
+		return
+	}
+
+	limitMsg, err := a.checkQuota(ctx, userID)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+	if limitMsg != "" {
+		a.sendMessageTo(ctx, bt, chatID, limitMsg, false)
+		return
+	}
+
+	a.logger.Info("消息被修改, 重新回答",
+		zap.Int64("UserID", userID),
+		zap.String("Chat Text", chatText),
+	)
+
+	err = a.handleAiChat(ctx, bt, userID, username, chatID, message.Chat.Type, chatText, message.ID, last.ID)
+	if errors.Is(err, errRoundNotLatest) {
+		return
+	}
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+	}
+}
+
+// handlerForMyChatMember 记录Bot在某个聊天中的状态变化, 例如被用户屏蔽
+func (a *Atri) handlerForMyChatMember(_ context.Context, _ *bot.Bot, member *models.ChatMemberUpdated) {
+	a.logger.Info("Bot的成员状态变化",
+		zap.Int64("Chat ID", member.Chat.ID),
+		zap.Int64("UserID", member.From.ID),
+		zap.String("Old", string(member.OldChatMember.Type)),
+		zap.String("New", string(member.NewChatMember.Type)),
+	)
+}
+
+// handlerForInlineQuery 暂不支持内联查询, 返回空结果避免客户端一直等待
+func (a *Atri) handlerForInlineQuery(ctx context.Context, bt *bot.Bot, query *models.InlineQuery) {
+	_, err := bt.AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+		InlineQueryID: query.ID,
+		Results:       []models.InlineQueryResult{},
+		IsPersonal:    true,
+	})
+	if err != nil {
+		a.logger.Error("应答内联查询失败", zap.Error(err))
+	}
+}
@@ -0,0 +1,247 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduleCheckInterval = 30 * time.Second // 检查到期定时提示词的间隔
+	maxSchedulesPerUser   = 10               // 每个用户最多的定时提示词数
+)
+
+// splitScheduleSpec 从原始文本中分出cron表达式和提示词, 提示词保留引号和换行.
+// cron表达式可以用引号括起来, 也可以是@daily等描述符或不加引号的5段表达式
+func splitScheduleSpec(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ""
+	}
+
+	if q := text[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(text[1:], q)
+		if end < 0 {
+			return "", ""
+		}
+		return text[1 : end+1], strings.TrimSpace(text[end+2:])
+	}
+
+	fields := 5
+	if text[0] == '@' {
+		fields = 1
+	}
+	spec, rest := []string{}, text
+	for range fields {
+		var word string
+		word, rest = cutFirstWord(rest)
+		if word == "" {
+			break
+		}
+		spec = append(spec, word)
+	}
+	return strings.Join(spec, " "), rest
+}
+
+// parseScheduleSpec 解析标准的5段cron表达式(分 时 日 月 周)或@daily等描述符, 按用户的时区执行
+func parseScheduleSpec(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// startScheduleLoop 在后台定期执行到期的定时提示词, 直到a.ctx结束
+func (a *Atri) startScheduleLoop() {
+	go func() {
+		ticker := time.NewTicker(scheduleCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			a.runDueSchedules(a.ctx)
+
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDueSchedules 执行所有到期的定时提示词. 停机期间错过的执行只补一次
+func (a *Atri) runDueSchedules(ctx context.Context) {
+	now := time.Now()
+	schedules, err := a.store.ListDueSchedules(ctx, now)
+	if err != nil {
+		a.logger.Error("加载到期的定时提示词失败", zap.Error(err))
+		return
+	}
+
+	for _, s := range schedules {
+		// 先安排下一次执行, 避免执行失败时被反复触发
+		if sched, err := parseScheduleSpec(s.Spec); err != nil {
+			a.logger.Error("无效的定时提示词, 已删除", zap.Uint("ScheduleID", s.ID), zap.String("Spec", s.Spec), zap.Error(err))
+			err = a.store.DeleteSchedule(ctx, s.UserID, s.ID)
+			if err != nil {
+				a.logger.Error("删除定时提示词失败", zap.Uint("ScheduleID", s.ID), zap.Error(err))
+			}
+			continue
+		} else if err := a.store.UpdateScheduleNext(ctx, s.ID, sched.Next(now.In(a.userLocation(ctx, s.UserID)))); err != nil {
+			a.logger.Error("更新定时提示词失败", zap.Uint("ScheduleID", s.ID), zap.Error(err))
+			continue
+		}
+
+		// 每个定时提示词在单独的goroutine中执行, 一次对话较慢时不会推迟其他用户的定时提示词
+		go a.runSchedule(ctx, s)
+	}
+}
+
+// runSchedule 以定时提示词的Prompt发起一轮对话, 与用户发送消息时一样检查白名单、封禁和额度
+func (a *Atri) runSchedule(ctx context.Context, s ScheduleRecord) {
+	bt := a.bot
+	// 私聊的ChatID与UserID相同
+	chatID := s.UserID
+	ctx = withLanguage(ctx, a.resolveLanguage(ctx, s.UserID, ""))
+
+	inBuck, err := a.hasUser(ctx, s.UserID)
+	if err != nil || !inBuck {
+		return
+	}
+	if ban, err := a.activeBan(ctx, s.UserID); err != nil || ban != nil {
+		return
+	}
+
+	limitMsg, err := a.checkQuota(ctx, s.UserID)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+		return
+	}
+	if limitMsg != "" {
+		a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.skipped", s.ID, limitMsg), false)
+		return
+	}
+
+	username := ""
+	if chat, err := bt.GetChat(ctx, &bot.GetChatParams{ChatID: chatID}); err == nil {
+		username = chat.Username
+	}
+
+	a.logger.Info("执行定时提示词", zap.Int64("UserID", s.UserID), zap.Uint("ScheduleID", s.ID))
+
+	err = a.handleAiChat(ctx, bt, s.UserID, username, chatID, models.ChatTypePrivate, s.Prompt, 0, 0)
+	if err != nil {
+		a.sendError(ctx, bt, chatID, err)
+	}
+}
+
+func (a *Atri) handleSchedule(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) == 0 {
+		return a.handleScheduleList(ctx, bt, chatID, userID, args)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "ls", "list":
+		return a.handleScheduleList(ctx, bt, chatID, userID, args[1:])
+	case "add":
+		return a.handleScheduleAdd(ctx, bt, chatID, userID, args[1:])
+	case "rm", "remove":
+		return a.handleScheduleRemove(ctx, bt, chatID, userID, args[1:])
+	default:
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.unknown_subcommand"), false)
+		return err
+	}
+}
+
+// handleScheduleAdd 添加定时提示词: /schedule add "<cron表达式>" <提示词>
+func (a *Atri) handleScheduleAdd(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
+	usage := a.t(ctx, "schedule.usage")
+
+	// 去掉子命令后读取原始文本, 提示词保留引号和换行
+	_, text := cutFirstWord(commandText(ctx))
+	spec, prompt := splitScheduleSpec(text)
+	if spec == "" || prompt == "" {
+		_, err := a.sendMessageTo(ctx, bt, chatID, usage, false)
+		return err
+	}
+
+	sched, err := parseScheduleSpec(spec)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.invalid_spec", err, usage), false)
+		return err
+	}
+
+	count, err := a.store.CountSchedules(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count >= maxSchedulesPerUser {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.too_many", maxSchedulesPerUser), false)
+		return err
+	}
+
+	loc := a.userLocation(ctx, userID)
+	schedule := &ScheduleRecord{
+		UserID: userID,
+		Spec:   spec,
+		Prompt: prompt,
+		NextAt: sched.Next(time.Now().In(loc)),
+	}
+	err = a.store.CreateSchedule(ctx, schedule)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.added", schedule.ID, schedule.NextAt.In(loc).Format(time.DateTime)), false)
+	return err
+}
+
+func (a *Atri) handleScheduleList(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, _ []string) error {
+	schedules, err := a.store.ListSchedules(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(schedules) == 0 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.empty", a.t(ctx, "schedule.usage")), false)
+		return err
+	}
+
+	loc := a.userLocation(ctx, userID)
+	var sb strings.Builder
+	for _, s := range schedules {
+		sb.WriteString(a.t(ctx, "schedule.list.item", s.ID, s.Spec, s.NextAt.In(loc).Format(time.DateTime), s.Prompt))
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.list", sb.String()), false)
+	return err
+}
+
+func (a *Atri) handleScheduleRemove(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if len(args) < 1 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.rm.missing_id"), false)
+		return err
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "id_not_number"), false)
+		return err
+	}
+
+	err = a.store.DeleteSchedule(ctx, userID, uint(id))
+	if errors.Is(err, ErrNotFound) {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "schedule.rm.not_found"), false)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "deleted"), false)
+	return err
+}
@@ -0,0 +1,28 @@
+package atri
+
+import "testing"
+
+func TestSplitScheduleSpec(t *testing.T) {
+	tests := []struct {
+		text   string
+		spec   string
+		prompt string
+	}{
+		{"", "", ""},
+		{`"0 9 * * 1-5" 早上好`, "0 9 * * 1-5", "早上好"},
+		{`'*/30 * * * *' say "hi"`, "*/30 * * * *", `say "hi"`},
+		{"\"0 8 * * *\" first line\n  second line", "0 8 * * *", "first line\n  second line"},
+		{`"0 8 * * *"`, "0 8 * * *", ""},
+		{`"0 8 * * *`, "", ""},
+		{"@daily summarize 'today'", "@daily", "summarize 'today'"},
+		{"0 9 * * * tell me \"the news\"\nplease", "0 9 * * *", "tell me \"the news\"\nplease"},
+		{"0 9 *", "0 9 *", ""},
+		{"  0  9 * * *   spaced   out  ", "0 9 * * *", "spaced   out"},
+	}
+	for _, tt := range tests {
+		spec, prompt := splitScheduleSpec(tt.text)
+		if spec != tt.spec || prompt != tt.prompt {
+			t.Errorf("splitScheduleSpec(%q) = %q, %q, want %q, %q", tt.text, spec, prompt, tt.spec, tt.prompt)
+		}
+	}
+}
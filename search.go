@@ -0,0 +1,123 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/openai/openai-go/v3"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+const (
+	searchResultLimit    = 10 // /search 最多显示的结果数
+	searchToolLimit      = 5  // search_history 工具默认返回的结果数
+	searchToolMaxLimit   = 20 // search_history 工具最多返回的结果数
+	searchSnippetRadius  = 40 // 摘要中匹配位置前后保留的字数
+	searchMaxQueryLength = 100
+)
+
+// searchSnippet 截取content中第一次匹配query附近的内容, 匹配不区分大小写
+func searchSnippet(content string, query string, radius int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	target := []rune(strings.ToLower(query))
+
+	start := 0
+	if idx := strings.Index(string(lower), string(target)); idx >= 0 {
+		start = len([]rune(string(lower)[:idx]))
+	}
+
+	// 转小写可能改变长度, 确保下标不越界
+	if start > len(runes) {
+		start = len(runes)
+	}
+	from := max(start-radius, 0)
+	to := min(start+len(target)+radius, len(runes))
+
+	snippet := string(runes[from:to])
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// searchHistory 查找用户历史对话中包含query的消息并格式化为文本, 没有结果时返回空字符串
+func (a *Atri) searchHistory(ctx context.Context, userID int64, query string, limit int) (string, error) {
+	messages, err := a.store.SearchMessages(ctx, userID, query, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	for _, m := range messages {
+		speaker := a.t(ctx, "search.user")
+		if m.Role == roleAssistant {
+			speaker = "Atri"
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", m.CreatedAt.Format(time.DateTime), speaker, searchSnippet(m.Content, query, searchSnippetRadius))
+	}
+	return sb.String(), nil
+}
+
+func (a *Atri) handleSearch(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	query := strings.Join(args, " ")
+	if query == "" {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "search.usage"), false)
+		return err
+	}
+	if len([]rune(query)) > searchMaxQueryLength {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "search.too_long"), false)
+		return err
+	}
+
+	result, err := a.searchHistory(ctx, userID, query, searchResultLimit)
+	if err != nil {
+		return err
+	}
+	if result == "" {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "search.not_found", query), false)
+		return err
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "search.result", searchResultLimit, result), false)
+	return err
+}
+
+// handleSearchHistoryTool 处理查找历史对话工具
+func (a *Atri) handleSearchHistoryTool(ctx context.Context, _ *bot.Bot, userID int64, callID string, callData string) openai.ChatCompletionMessageParamUnion {
+	queryParam, message, ok := a.assertAndGetToolArgument(callID, callData, "query", gjson.String)
+	if !ok {
+		return message
+	}
+	query := strings.TrimSpace(queryParam.String())
+	if query == "" {
+		return openai.ToolMessage("错误: 参数\"query\"不能为空.", callID)
+	}
+
+	limit := searchToolLimit
+	if l := gjson.Get(callData, "limit"); l.Type == gjson.Number {
+		limit = min(max(int(l.Int()), 1), searchToolMaxLimit)
+	}
+
+	result, err := a.searchHistory(ctx, userID, query, limit)
+	if err != nil {
+		a.logger.Error("查找历史对话失败!", zap.Error(err))
+		return openai.ToolMessage(fmt.Sprintf("错误: 查找失败. %s", err), callID)
+	}
+	if result == "" {
+		return openai.ToolMessage(fmt.Sprintf("没有找到包含\"%s\"的历史对话.", query), callID)
+	}
+
+	return openai.ToolMessage(result, callID)
+}
@@ -0,0 +1,106 @@
+package atri
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
+)
+
+// userSettings 加载用户的设置, 加载失败时记录日志并返回空的设置
+func (a *Atri) userSettings(ctx context.Context, userID int64) UserSettingsRecord {
+	settings, err := a.store.GetUserSettings(ctx, userID)
+	if err != nil {
+		a.logger.Error("加载用户设置失败", zap.Int64("UserID", userID), zap.Error(err))
+		return UserSettingsRecord{UserID: userID}
+	}
+	return settings
+}
+
+// userLocation 返回用户设置的时区, 没有设置或无法加载时使用服务器的时区
+func (a *Atri) userLocation(ctx context.Context, userID int64) *time.Location {
+	settings := a.userSettings(ctx, userID)
+	if settings.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		a.logger.Warn("无法加载用户的时区", zap.Int64("UserID", userID), zap.String("Timezone", settings.Timezone), zap.Error(err))
+		return time.Local
+	}
+	return loc
+}
+
+// handleSettings 查看或修改个人设置: /settings [tz|lang] [值|reset]
+func (a *Atri) handleSettings(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	settings, err := a.store.GetUserSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		timezone := settings.Timezone
+		if timezone == "" {
+			timezone = a.t(ctx, "settings.default_timezone", time.Local)
+		}
+		language := settings.Language
+		if language == "" {
+			language = a.t(ctx, "settings.default")
+		}
+
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.show", timezone, language, strings.Join(a.languages(), "|")), false)
+		return err
+	}
+
+	if len(args) < 2 {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.usage"), false)
+		return err
+	}
+
+	value := args[1]
+	reset := strings.ToLower(value) == "reset"
+
+	switch strings.ToLower(args[0]) {
+	case "tz", "timezone":
+		if reset {
+			settings.Timezone = ""
+			break
+		}
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "" || value == "Local" {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.invalid_timezone"), false)
+			return err
+		}
+		settings.Timezone = loc.String()
+	case "lang", "language":
+		if reset {
+			settings.Language = ""
+			break
+		}
+		language := strings.ToLower(value)
+		if !slices.Contains(a.languages(), language) {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.invalid_language", strings.Join(a.languages(), ", ")), false)
+			return err
+		}
+		settings.Language = language
+	default:
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.unknown"), false)
+		return err
+	}
+
+	err = a.store.SaveUserSettings(ctx, &settings)
+	if err != nil {
+		return err
+	}
+
+	// 立即使用新的语言回复
+	if settings.Language != "" {
+		ctx = withLanguage(ctx, settings.Language)
+	}
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "settings.saved"), false)
+	return err
+}
@@ -4,7 +4,8 @@ import "github.com/go-telegram/bot"
 
 func (a *Atri) setupBot() error {
 	opts := []bot.Option{
-		bot.WithDefaultHandler(a.handlerForTextMessage),
+		bot.WithDefaultHandler(a.handlerForUpdate),
+		bot.WithAllowedUpdates(allowedUpdates),
 	}
 
 	if a.config.CheckInitTimeout != 0 {
@@ -23,5 +24,21 @@ func (a *Atri) setupBot() error {
 }
 
 func (a *Atri) setupDB() error {
-	return a.db.AutoMigrate(&memoryRecord{}, &allowedUserRecord{}, &roundRecord{})
+	return a.store.Migrate(a.ctx)
+}
+
+func (a *Atri) setupEncryption() error {
+	if len(a.config.EncryptionKeys) == 0 {
+		return nil
+	}
+
+	store, err := newEncryptedStore(a.store, a.config.EncryptionKeys)
+	if err != nil {
+		return err
+	}
+
+	a.store = store
+	a.logger.Info("已启用存储加密")
+
+	return nil
 }
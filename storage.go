@@ -0,0 +1,127 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound 表示要查找的记录不存在
+	ErrNotFound = errors.New("记录不存在")
+	// ErrInviteUnusable 表示邀请码不存在、已撤销、已用完或已过期
+	ErrInviteUnusable = errors.New("邀请码不可用")
+	// ErrAccessRequestDecided 表示访问申请已经被处理过
+	ErrAccessRequestDecided = errors.New("申请已经被处理过")
+)
+
+// Store 是Atri的持久化接口, 查找不到记录时应返回ErrNotFound
+type Store interface {
+	// Migrate 初始化存储, 在Start时调用
+	Migrate(ctx context.Context) error
+	// RewriteEncryptedFields 对对话、记忆、提醒和定时提示词中需要加密的字段里不以skipPrefix开头的非空值调用rewrite并写回,
+	// 包括已软删除的记录. 用于加密启用加密之前的明文和更换主密钥后重新加密, 返回改写的字段数
+	RewriteEncryptedFields(ctx context.Context, skipPrefix string, rewrite func(string) (string, error)) (int64, error)
+
+	HasAnyUser(ctx context.Context) (bool, error)
+	// GetUser 加载白名单中的用户, 同一用户有多条记录时返回最新的一条
+	GetUser(ctx context.Context, userID int64) (AllowedUserRecord, error)
+	CreateUser(ctx context.Context, userID int64, isAdmin bool) error
+	DeleteUser(ctx context.Context, userID int64) error
+	// DeleteUserData 彻底删除用户的对话、记忆、提醒、定时提示词、设置和访问申请, 不会删除白名单记录和用量统计
+	DeleteUserData(ctx context.Context, userID int64) error
+	ListUsers(ctx context.Context) ([]AllowedUserRecord, error)
+	ListUsersPage(ctx context.Context, offset int, limit int) ([]AllowedUserRecord, error)
+	CountUsers(ctx context.Context) (int64, error)
+	ListAdmins(ctx context.Context) ([]AllowedUserRecord, error)
+	// UpdateUserAdmin 设置用户是否为管理员, 会清除用户的角色使其按IsAdmin推断
+	UpdateUserAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	// UpdateUserRole 设置用户的角色, 同时将IsAdmin同步为角色是否为admin
+	UpdateUserRole(ctx context.Context, userID int64, role string) error
+
+	ListMemories(ctx context.Context, userID int64) ([]MemoryRecord, error)
+	ListMemoriesPage(ctx context.Context, userID int64, offset int, limit int) ([]MemoryRecord, error)
+	CountMemories(ctx context.Context, userID int64) (int64, error)
+	GetMemory(ctx context.Context, userID int64, memoryID uint) (MemoryRecord, error)
+	CreateMemory(ctx context.Context, userID int64, memory string) error
+	// DeleteMemory 彻底删除用户的一条记忆
+	DeleteMemory(ctx context.Context, userID int64, memoryID uint) error
+	// PurgeMemories 彻底删除创建时间早于before的记忆, 返回删除的条数
+	PurgeMemories(ctx context.Context, before time.Time) (int64, error)
+
+	// CreateRound 写入一轮对话及其Messages, 成功后record.ID为新记录的ID.
+	// 对话按CreatedAt(相同时按ID)排序, CreatedAt为零值时使用当前时间
+	CreateRound(ctx context.Context, record *RoundRecord) error
+	// ListRecentRounds 按从新到旧的顺序加载最近的对话及其Messages, limit不大于0时加载全部
+	ListRecentRounds(ctx context.Context, userID int64, limit int) ([]RoundRecord, error)
+	// ListRoundsSince 按从旧到新的顺序加载某一时间(含)之后的对话及其Messages
+	ListRoundsSince(ctx context.Context, userID int64, since time.Time) ([]RoundRecord, error)
+	GetLastRound(ctx context.Context, userID int64) (RoundRecord, error)
+	// DeleteRound 删除一轮对话及其Messages
+	DeleteRound(ctx context.Context, userID int64, roundID uint) error
+	CountRounds(ctx context.Context, userID int64) (int64, error)
+	// PurgeRounds 彻底删除创建时间早于before的对话, 并且每个用户只保留最近的keep轮; 零值表示不按该条件删除. 返回删除的轮数
+	PurgeRounds(ctx context.Context, before time.Time, keep int) (int64, error)
+	// SearchMessages 按从新到旧的顺序查找内容包含query(不区分大小写)的用户和助手消息, limit不大于0时返回全部
+	SearchMessages(ctx context.Context, userID int64, query string, limit int) ([]MessageRecord, error)
+
+	// AddUsage 将delta累加到同一用户/日期/模型的用量记录上, 不存在时创建
+	AddUsage(ctx context.Context, delta UsageRecord) error
+	// ListUsageSince 加载某一天(含)之后的用量记录, userID为0时加载所有用户
+	ListUsageSince(ctx context.Context, userID int64, day string) ([]UsageRecord, error)
+
+	// GetUserQuota 加载用户的额度覆盖, 不存在时返回只有UserID的空记录
+	GetUserQuota(ctx context.Context, userID int64) (UserQuotaRecord, error)
+	SaveUserQuota(ctx context.Context, record *UserQuotaRecord) error
+
+	// GetUserSettings 加载用户的设置, 不存在时返回只有UserID的空记录
+	GetUserSettings(ctx context.Context, userID int64) (UserSettingsRecord, error)
+	SaveUserSettings(ctx context.Context, record *UserSettingsRecord) error
+
+	CreateInvite(ctx context.Context, invite *InviteRecord) error
+	ListInvites(ctx context.Context) ([]InviteRecord, error)
+	RevokeInvite(ctx context.Context, code string) error
+	// RedeemInvite 原子地消耗一次邀请码并将用户加入白名单, 邀请码不可用时返回ErrInviteUnusable
+	RedeemInvite(ctx context.Context, code string, userID int64, now time.Time) (InviteRecord, error)
+
+	// GetLastAccessRequest 加载用户最近的一条访问申请, 不论状态
+	GetLastAccessRequest(ctx context.Context, userID int64) (AccessRequestRecord, error)
+	CreateAccessRequest(ctx context.Context, request *AccessRequestRecord) error
+	// DecideAccessRequest 处理一条待审核的访问申请, 批准时会同时将用户加入白名单; 已处理过时返回ErrAccessRequestDecided
+	DecideAccessRequest(ctx context.Context, requestID uint, adminID int64, approve bool) (AccessRequestRecord, error)
+
+	// GetActiveBan 加载用户当前有效的封禁, 没有或已过期时返回ErrNotFound
+	GetActiveBan(ctx context.Context, userID int64, now time.Time) (BanRecord, error)
+	// SaveBan 封禁用户, 会替换该用户已有的封禁
+	SaveBan(ctx context.Context, ban *BanRecord) error
+	// DeleteBan 解除用户的封禁
+	DeleteBan(ctx context.Context, userID int64) error
+	// ListActiveBans 加载所有当前有效的封禁
+	ListActiveBans(ctx context.Context, now time.Time) ([]BanRecord, error)
+
+	CreateReminder(ctx context.Context, reminder *ReminderRecord) error
+	// ListReminders 按提醒时间从早到晚加载用户的提醒
+	ListReminders(ctx context.Context, userID int64) ([]ReminderRecord, error)
+	// DeleteReminder 彻底删除用户的一条提醒
+	DeleteReminder(ctx context.Context, userID int64, reminderID uint) error
+	// ListDueReminders 加载所有用户提醒时间不晚于now的提醒
+	ListDueReminders(ctx context.Context, now time.Time) ([]ReminderRecord, error)
+	// UpdateReminderNext 设置重复提醒的下一次提醒时间
+	UpdateReminderNext(ctx context.Context, reminderID uint, next time.Time) error
+
+	CreateSchedule(ctx context.Context, schedule *ScheduleRecord) error
+	// ListSchedules 按下一次执行的时间从早到晚加载用户的定时提示词
+	ListSchedules(ctx context.Context, userID int64) ([]ScheduleRecord, error)
+	CountSchedules(ctx context.Context, userID int64) (int64, error)
+	// DeleteSchedule 彻底删除用户的一条定时提示词
+	DeleteSchedule(ctx context.Context, userID int64, scheduleID uint) error
+	// ListDueSchedules 加载所有用户下一次执行时间不晚于now的定时提示词
+	ListDueSchedules(ctx context.Context, now time.Time) ([]ScheduleRecord, error)
+	UpdateScheduleNext(ctx context.Context, scheduleID uint, next time.Time) error
+
+	CreateAudit(ctx context.Context, record *AuditRecord) error
+	// ListRecentAudits 按从新到旧的顺序加载最近的审计日志
+	ListRecentAudits(ctx context.Context, limit int) ([]AuditRecord, error)
+	// PurgeAudits 彻底删除创建时间早于before的审计日志, 返回删除的条数
+	PurgeAudits(ctx context.Context, before time.Time) (int64, error)
+}
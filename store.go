@@ -2,20 +2,26 @@ package atri
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"slices"
+	"time"
 
+	"github.com/openai/openai-go/v3"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
+// errRoundNotLatest 表示要重新回答的一轮对话不是最新的一轮
+var errRoundNotLatest = errors.New("不是最新的一轮对话")
+
+// isUserInBuck 判断用户是否在白名单内, 开启了Bootstrap.AutoPromoteFirstUser时, 白名单为空则将该用户设为首个管理员
 func (a *Atri) isUserInBuck(ctx context.Context, userID int64) bool {
-	hasAny, err := a.hasAnyUser(ctx)
+	hasAny, err := a.store.HasAnyUser(ctx)
 	if err != nil {
 		return false
 	}
-	if !hasAny {
-		err := a.createUser(ctx, userID, true)
+	if !hasAny && a.config.Bootstrap.AutoPromoteFirstUser {
+		err := a.store.CreateUser(ctx, userID, true)
+		a.audit(ctx, userID, "bootstrap.admin", userID, "", auditOutcome(err))
 		if err != nil {
 			a.logger.Error("创建首个管理员失败", zap.Error(err))
 			return false
@@ -24,7 +30,7 @@ func (a *Atri) isUserInBuck(ctx context.Context, userID int64) bool {
 		return true
 	}
 
-	_, err = gorm.G[allowedUserRecord](a.db).Where("user_id = ?", userID).Last(ctx)
+	_, err = a.store.GetUser(ctx, userID)
 	if err != nil {
 		return false
 	}
@@ -32,121 +38,36 @@ func (a *Atri) isUserInBuck(ctx context.Context, userID int64) bool {
 	return true
 }
 
-func (a *Atri) hasAnyUser(ctx context.Context) (bool, error) {
-	var count int64
-	records, err := gorm.G[allowedUserRecord](a.db).Limit(1).Find(ctx)
-	if err != nil {
-		return false, err
-	}
-	count = int64(len(records))
-	return count > 0, nil
-}
-
-func (a *Atri) createUser(ctx context.Context, userID int64, isAdmin bool) error {
-	err := gorm.G[allowedUserRecord](a.db).Create(ctx, &allowedUserRecord{
-		UserID:  userID,
-		IsAdmin: isAdmin,
-	})
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (a *Atri) deleteUser(ctx context.Context, userID int64) error {
-	_, err := gorm.G[allowedUserRecord](a.db).Where("user_id = ?", userID).Delete(ctx)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (a *Atri) loadUsers(ctx context.Context) ([]allowedUserRecord, error) {
-	records, err := gorm.G[allowedUserRecord](a.db).Find(ctx)
-	if err != nil {
-		return nil, err
+// hasUser 判断用户是否在白名单内, 与isUserInBuck不同, 它不会创建首个管理员
+func (a *Atri) hasUser(ctx context.Context, userID int64) (bool, error) {
+	_, err := a.store.GetUser(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
 	}
-	return records, nil
-}
-
-func (a *Atri) updateUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
-	_, err := gorm.G[allowedUserRecord](a.db).Where("user_id = ?", userID).Update(ctx, "is_admin", isAdmin)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+	return true, nil
 }
 
 func (a *Atri) isAdmin(ctx context.Context, userID int64) bool {
-	record, err := gorm.G[allowedUserRecord](a.db).Where("user_id = ? AND is_admin = ?", userID, true).Last(ctx)
+	record, err := a.store.GetUser(ctx, userID)
 	if err != nil {
 		return false
 	}
 	return record.IsAdmin
 }
 
-func (a *Atri) countHistoryInDB(ctx context.Context, userID int64) (int64, error) {
-	var count int64
-	err := a.db.WithContext(ctx).Model(&roundRecord{}).Where("user_id = ?", userID).Count(&count).Error
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-// loadMemories 从数据库加载记忆（不会上锁）
-func (a *Atri) loadMemories(ctx context.Context, userID int64) ([]memoryRecord, error) {
-	records, err := gorm.G[memoryRecord](a.db).Where("user_id = ?", userID).Find(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return records, nil
-}
-
-// createMemory 创建一条新记忆（不会上锁）
-func (a *Atri) createMemory(ctx context.Context, userID int64, memory string) error {
-	err := gorm.G[memoryRecord](a.db).Create(ctx, &memoryRecord{UserID: userID, Memory: memory})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (a *Atri) deleteMemory(ctx context.Context, userID int64, memoryID uint) error {
-	mem, err := gorm.G[memoryRecord](a.db).Where("id = ?", memoryID).Last(ctx)
-	if err != nil {
-		return err
-	}
-	if mem.UserID != userID {
-		return gorm.ErrRecordNotFound
-	}
-
-	_, err = gorm.G[memoryRecord](a.db).Where("id = ? AND user_id = ?", memoryID, userID).Delete(ctx)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
+// fillSessionHistoryFromDB 从数据库加载最近的对话作为会话的History, 调用前需要持有session.lock
 func (a *Atri) fillSessionHistoryFromDB(ctx context.Context, session *userSession, userID int64) error {
-	maxRounds := a.config.MaxRounds
-	query := gorm.G[roundRecord](a.db).Where("user_id = ?", userID).Order("id DESC")
-	if maxRounds > 0 {
-		query = query.Limit(maxRounds)
-	}
-	roundsInDB, err := query.Find(ctx)
+	roundsInDB, err := a.store.ListRecentRounds(ctx, userID, a.config.MaxRounds)
 	if err != nil {
 		return err
 	}
 
 	res := []roundHistory{}
 	for _, round := range roundsInDB {
-		tmp := roundHistory{}
-
-		err = json.Unmarshal([]byte(round.InJSON), &tmp)
+		tmp, err := round.history()
 		if err != nil {
 			return err
 		}
@@ -167,20 +88,32 @@ func (a *Atri) fillSessionHistoryFromDB(ctx context.Context, session *userSessio
 	return nil
 }
 
-// writeHistoryToDB 将新的历史记录写入数据库
-func (a *Atri) writeHistoryToDB(ctx context.Context, diffed roundHistory, userID int64) error {
+// writeHistoryToDB 将新的历史记录写入数据库, 返回该轮的ID; messageUsage是每条助手消息(按下标)生成时的用量
+func (a *Atri) writeHistoryToDB(ctx context.Context, diffed roundHistory, messageUsage map[int]openai.CompletionUsage, userID int64, messageID int, usage openai.CompletionUsage) (uint, error) {
 	if len(diffed) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	inJSON, err := json.Marshal(diffed)
+	messages, err := roundToMessages(diffed)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	for i, u := range messageUsage {
+		messages[i].PromptTokens = u.PromptTokens
+		messages[i].CompletionTokens = u.CompletionTokens
 	}
 
-	err = gorm.G[roundRecord](a.db).Create(ctx, &roundRecord{UserID: userID, InJSON: string(inJSON)})
+	record := &RoundRecord{
+		UserID:           userID,
+		MessageID:        messageID,
+		ModelName:        a.config.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Messages:         messages,
+	}
+	err = a.store.CreateRound(ctx, record)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	a.logger.Info(
@@ -188,5 +121,23 @@ func (a *Atri) writeHistoryToDB(ctx context.Context, diffed roundHistory, userID
 		zap.Int64("UserID", userID),
 		zap.Int("Messages", len(diffed)),
 	)
-	return nil
+	return record.ID, nil
+}
+
+// recordUsage 将一轮对话的用量累加到按用户/日期/模型聚合的用量表
+func (a *Atri) recordUsage(ctx context.Context, userID int64, model string, usage openai.CompletionUsage) error {
+	return a.store.AddUsage(ctx, UsageRecord{
+		UserID:           userID,
+		Day:              time.Now().Format(time.DateOnly),
+		ModelName:        model,
+		Rounds:           1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             a.calcCost(model, usage.PromptTokens, usage.CompletionTokens),
+	})
+}
+
+// loadUsageSince 加载某一天(含)之后的用量记录, userID为0时加载所有用户
+func (a *Atri) loadUsageSince(ctx context.Context, userID int64, since time.Time) ([]UsageRecord, error) {
+	return a.store.ListUsageSince(ctx, userID, since.Format(time.DateOnly))
 }
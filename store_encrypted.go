@@ -0,0 +1,240 @@
+package atri
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// encryptedStore 包装另一个Store, 在写入前加密对话、记忆、提醒和定时提示词的内容, 在读取后解密
+type encryptedStore struct {
+	Store
+	keys *keyring
+}
+
+// newEncryptedStore 创建一个加密的Store, keys的第一个密钥用于加密, 其余的仅用于解密旧数据
+func newEncryptedStore(store Store, keys [][]byte) (Store, error) {
+	k, err := newKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStore{Store: store, keys: k}, nil
+}
+
+// Migrate 在底层的Store初始化之后, 加密其中的明文(包括从旧版本迁移的对话), 并使用主密钥重新加密旧密钥加密的数据.
+// 因此移除旧密钥之前, 需要先将新密钥作为主密钥启动一次
+func (s *encryptedStore) Migrate(ctx context.Context) error {
+	if err := s.Store.Migrate(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.Store.RewriteEncryptedFields(ctx, s.keys.primaryPrefix(), s.keys.rewrap)
+	return err
+}
+
+func (s *encryptedStore) decryptMemories(records []MemoryRecord, err error) ([]MemoryRecord, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].Memory, err = s.keys.decrypt(records[i].Memory); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (s *encryptedStore) encryptMessage(m *MessageRecord) (err error) {
+	if m.Content, err = s.keys.encrypt(m.Content); err != nil {
+		return err
+	}
+	m.ToolCalls, err = s.keys.encrypt(m.ToolCalls)
+	return err
+}
+
+func (s *encryptedStore) decryptMessage(m *MessageRecord) (err error) {
+	if m.Content, err = s.keys.decrypt(m.Content); err != nil {
+		return err
+	}
+	m.ToolCalls, err = s.keys.decrypt(m.ToolCalls)
+	return err
+}
+
+func (s *encryptedStore) decryptRound(r *RoundRecord) (err error) {
+	if r.InJSON, err = s.keys.decrypt(r.InJSON); err != nil {
+		return err
+	}
+	for i := range r.Messages {
+		if err := s.decryptMessage(&r.Messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *encryptedStore) decryptRounds(records []RoundRecord, err error) ([]RoundRecord, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if err := s.decryptRound(&records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (s *encryptedStore) ListMemories(ctx context.Context, userID int64) ([]MemoryRecord, error) {
+	return s.decryptMemories(s.Store.ListMemories(ctx, userID))
+}
+
+func (s *encryptedStore) ListMemoriesPage(ctx context.Context, userID int64, offset int, limit int) ([]MemoryRecord, error) {
+	return s.decryptMemories(s.Store.ListMemoriesPage(ctx, userID, offset, limit))
+}
+
+func (s *encryptedStore) GetMemory(ctx context.Context, userID int64, memoryID uint) (MemoryRecord, error) {
+	record, err := s.Store.GetMemory(ctx, userID, memoryID)
+	if err != nil {
+		return MemoryRecord{}, err
+	}
+	record.Memory, err = s.keys.decrypt(record.Memory)
+	return record, err
+}
+
+func (s *encryptedStore) CreateMemory(ctx context.Context, userID int64, memory string) error {
+	encrypted, err := s.keys.encrypt(memory)
+	if err != nil {
+		return err
+	}
+	return s.Store.CreateMemory(ctx, userID, encrypted)
+}
+
+func (s *encryptedStore) CreateRound(ctx context.Context, record *RoundRecord) error {
+	// 在拷贝上加密, 调用方持有的record保持明文
+	encrypted := *record
+	encrypted.Messages = slices.Clone(record.Messages)
+	for i := range encrypted.Messages {
+		if err := s.encryptMessage(&encrypted.Messages[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Store.CreateRound(ctx, &encrypted); err != nil {
+		return err
+	}
+
+	record.Model = encrypted.Model
+	for i := range record.Messages {
+		record.Messages[i].Model = encrypted.Messages[i].Model
+		record.Messages[i].RoundID = encrypted.Messages[i].RoundID
+	}
+	return nil
+}
+
+func (s *encryptedStore) ListRecentRounds(ctx context.Context, userID int64, limit int) ([]RoundRecord, error) {
+	return s.decryptRounds(s.Store.ListRecentRounds(ctx, userID, limit))
+}
+
+func (s *encryptedStore) ListRoundsSince(ctx context.Context, userID int64, since time.Time) ([]RoundRecord, error) {
+	return s.decryptRounds(s.Store.ListRoundsSince(ctx, userID, since))
+}
+
+func (s *encryptedStore) GetLastRound(ctx context.Context, userID int64) (RoundRecord, error) {
+	record, err := s.Store.GetLastRound(ctx, userID)
+	if err != nil {
+		return RoundRecord{}, err
+	}
+	err = s.decryptRound(&record)
+	return record, err
+}
+
+// SearchMessages 无法在数据库中匹配密文, 只能加载用户的全部对话后在内存中查找
+func (s *encryptedStore) SearchMessages(ctx context.Context, userID int64, query string, limit int) ([]MessageRecord, error) {
+	rounds, err := s.ListRecentRounds(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	results := []MessageRecord{}
+	for _, round := range rounds {
+		for i := len(round.Messages) - 1; i >= 0; i-- {
+			m := round.Messages[i]
+			if (m.Role == roleUser || m.Role == roleAssistant) && strings.Contains(strings.ToLower(m.Content), query) {
+				results = append(results, m)
+			}
+		}
+	}
+	return paginate(results, 0, limit), nil
+}
+
+func (s *encryptedStore) decryptReminders(records []ReminderRecord, err error) ([]ReminderRecord, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].Text, err = s.keys.decrypt(records[i].Text); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (s *encryptedStore) CreateReminder(ctx context.Context, reminder *ReminderRecord) (err error) {
+	// 在拷贝上加密, 调用方持有的reminder保持明文
+	encrypted := *reminder
+	if encrypted.Text, err = s.keys.encrypt(reminder.Text); err != nil {
+		return err
+	}
+
+	if err := s.Store.CreateReminder(ctx, &encrypted); err != nil {
+		return err
+	}
+
+	reminder.Model = encrypted.Model
+	return nil
+}
+
+func (s *encryptedStore) ListReminders(ctx context.Context, userID int64) ([]ReminderRecord, error) {
+	return s.decryptReminders(s.Store.ListReminders(ctx, userID))
+}
+
+func (s *encryptedStore) ListDueReminders(ctx context.Context, now time.Time) ([]ReminderRecord, error) {
+	return s.decryptReminders(s.Store.ListDueReminders(ctx, now))
+}
+
+func (s *encryptedStore) decryptSchedules(records []ScheduleRecord, err error) ([]ScheduleRecord, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].Prompt, err = s.keys.decrypt(records[i].Prompt); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (s *encryptedStore) CreateSchedule(ctx context.Context, schedule *ScheduleRecord) (err error) {
+	// 在拷贝上加密, 调用方持有的schedule保持明文
+	encrypted := *schedule
+	if encrypted.Prompt, err = s.keys.encrypt(schedule.Prompt); err != nil {
+		return err
+	}
+
+	if err := s.Store.CreateSchedule(ctx, &encrypted); err != nil {
+		return err
+	}
+
+	schedule.Model = encrypted.Model
+	return nil
+}
+
+func (s *encryptedStore) ListSchedules(ctx context.Context, userID int64) ([]ScheduleRecord, error) {
+	return s.decryptSchedules(s.Store.ListSchedules(ctx, userID))
+}
+
+func (s *encryptedStore) ListDueSchedules(ctx context.Context, now time.Time) ([]ScheduleRecord, error) {
+	return s.decryptSchedules(s.Store.ListDueSchedules(ctx, now))
+}
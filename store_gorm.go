@@ -0,0 +1,630 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormStore 是基于GORM的Store实现
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建一个基于GORM的Store
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+// wrapErr 将GORM的错误转换为Store的错误
+func wrapErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *gormStore) Migrate(ctx context.Context) error {
+	err := s.db.WithContext(ctx).AutoMigrate(
+		&MemoryRecord{},
+		&AllowedUserRecord{},
+		&RoundRecord{},
+		&MessageRecord{},
+		&UsageRecord{},
+		&UserQuotaRecord{},
+		&UserSettingsRecord{},
+		&InviteRecord{},
+		&AccessRequestRecord{},
+		&AuditRecord{},
+		&BanRecord{},
+		&ReminderRecord{},
+		&ScheduleRecord{},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = s.migrateLegacyRounds(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.backfillMessageUserIDs(ctx)
+}
+
+// backfillMessageUserIDs 为旧版本写入的UserID为0的消息补上所属轮次的UserID
+func (s *gormStore) backfillMessageUserIDs(ctx context.Context) error {
+	rounds := s.db.Model(&RoundRecord{}).Unscoped().Select("user_id").Where("round_records.id = message_records.round_id")
+	return s.db.WithContext(ctx).Unscoped().Model(&MessageRecord{}).Where("user_id = ?", 0).Update("user_id", rounds).Error
+}
+
+// migrateLegacyRounds 将旧版本保存在InJSON中的整轮对话拆分为MessageRecord
+func (s *gormStore) migrateLegacyRounds(ctx context.Context) error {
+	for {
+		rounds, err := gorm.G[RoundRecord](s.db).Where("in_json <> ?", "").Order("id ASC").Limit(100).Find(ctx)
+		if err != nil {
+			return err
+		}
+		if len(rounds) == 0 {
+			return nil
+		}
+
+		for _, round := range rounds {
+			history, err := round.history()
+			if err != nil {
+				return err
+			}
+			messages, err := roundToMessages(history)
+			if err != nil {
+				return err
+			}
+
+			err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				for i := range messages {
+					messages[i].RoundID = round.ID
+					messages[i].UserID = round.UserID
+					messages[i].CreatedAt = round.CreatedAt
+				}
+				if len(messages) > 0 {
+					err := gorm.G[MessageRecord](tx).CreateInBatches(ctx, &messages, 100)
+					if err != nil {
+						return err
+					}
+				}
+
+				_, err := gorm.G[RoundRecord](tx).Where("id = ?", round.ID).Update(ctx, "in_json", "")
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// encryptedColumns 是需要加密的字段所在的表和列
+var encryptedColumns = []struct {
+	model  any
+	column string
+}{
+	{&MemoryRecord{}, "memory"},
+	{&RoundRecord{}, "in_json"},
+	{&MessageRecord{}, "content"},
+	{&MessageRecord{}, "tool_calls"},
+	{&ReminderRecord{}, "text"},
+	{&ScheduleRecord{}, "prompt"},
+}
+
+func (s *gormStore) RewriteEncryptedFields(ctx context.Context, skipPrefix string, rewrite func(string) (string, error)) (int64, error) {
+	var total int64
+	for _, c := range encryptedColumns {
+		column := clause.Column{Name: c.column}
+		lastID := uint(0)
+		for {
+			rows := []struct {
+				ID    uint
+				Value string
+			}{}
+			err := s.db.WithContext(ctx).Unscoped().Model(c.model).
+				Select("id, ? AS value", column).
+				Where("id > ? AND ? <> ? AND ? NOT LIKE ? ESCAPE '!'", lastID, column, "", column, escapeLike(skipPrefix)+"%").
+				Order("id ASC").Limit(100).Scan(&rows).Error
+			if err != nil {
+				return total, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				value, err := rewrite(row.Value)
+				if err != nil {
+					return total, err
+				}
+				err = s.db.WithContext(ctx).Unscoped().Model(c.model).Where("id = ?", row.ID).UpdateColumn(c.column, value).Error
+				if err != nil {
+					return total, err
+				}
+				total++
+				lastID = row.ID
+			}
+		}
+	}
+	return total, nil
+}
+
+func (s *gormStore) HasAnyUser(ctx context.Context) (bool, error) {
+	records, err := gorm.G[AllowedUserRecord](s.db).Limit(1).Find(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+func (s *gormStore) GetUser(ctx context.Context, userID int64) (AllowedUserRecord, error) {
+	record, err := gorm.G[AllowedUserRecord](s.db).Where("user_id = ?", userID).Last(ctx)
+	return record, wrapErr(err)
+}
+
+func (s *gormStore) CreateUser(ctx context.Context, userID int64, isAdmin bool) error {
+	return gorm.G[AllowedUserRecord](s.db).Create(ctx, &AllowedUserRecord{
+		UserID:  userID,
+		IsAdmin: isAdmin,
+	})
+}
+
+func (s *gormStore) DeleteUser(ctx context.Context, userID int64) error {
+	_, err := gorm.G[AllowedUserRecord](s.db).Where("user_id = ?", userID).Delete(ctx)
+	return err
+}
+
+func (s *gormStore) DeleteUserData(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		// 按轮次删除消息, 旧版本写入的消息可能没有UserID
+		if _, err := deleteRoundsWhere(tx, "user_id = ?", userID); err != nil {
+			return err
+		}
+		for _, model := range []any{&MessageRecord{}, &MemoryRecord{}, &ReminderRecord{}, &ScheduleRecord{}, &UserSettingsRecord{}, &AccessRequestRecord{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *gormStore) ListUsers(ctx context.Context) ([]AllowedUserRecord, error) {
+	return gorm.G[AllowedUserRecord](s.db).Find(ctx)
+}
+
+func (s *gormStore) ListUsersPage(ctx context.Context, offset int, limit int) ([]AllowedUserRecord, error) {
+	return gorm.G[AllowedUserRecord](s.db).Order("id ASC").Offset(offset).Limit(limit).Find(ctx)
+}
+
+func (s *gormStore) CountUsers(ctx context.Context) (int64, error) {
+	return gorm.G[AllowedUserRecord](s.db).Count(ctx, "id")
+}
+
+func (s *gormStore) ListAdmins(ctx context.Context) ([]AllowedUserRecord, error) {
+	return gorm.G[AllowedUserRecord](s.db).Where("is_admin = ?", true).Find(ctx)
+}
+
+func (s *gormStore) UpdateUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	err := s.db.WithContext(ctx).Model(&AllowedUserRecord{}).Where("user_id = ?", userID).Updates(map[string]any{"is_admin": isAdmin, "role": ""}).Error
+	return err
+}
+
+func (s *gormStore) UpdateUserRole(ctx context.Context, userID int64, role string) error {
+	err := s.db.WithContext(ctx).Model(&AllowedUserRecord{}).Where("user_id = ?", userID).Updates(map[string]any{"is_admin": role == RoleAdmin, "role": role}).Error
+	return err
+}
+
+func (s *gormStore) ListMemories(ctx context.Context, userID int64) ([]MemoryRecord, error) {
+	return gorm.G[MemoryRecord](s.db).Where("user_id = ?", userID).Find(ctx)
+}
+
+func (s *gormStore) ListMemoriesPage(ctx context.Context, userID int64, offset int, limit int) ([]MemoryRecord, error) {
+	return gorm.G[MemoryRecord](s.db).Where("user_id = ?", userID).Order("id ASC").Offset(offset).Limit(limit).Find(ctx)
+}
+
+func (s *gormStore) CountMemories(ctx context.Context, userID int64) (int64, error) {
+	return gorm.G[MemoryRecord](s.db).Where("user_id = ?", userID).Count(ctx, "id")
+}
+
+func (s *gormStore) GetMemory(ctx context.Context, userID int64, memoryID uint) (MemoryRecord, error) {
+	record, err := gorm.G[MemoryRecord](s.db).Where("id = ? AND user_id = ?", memoryID, userID).Last(ctx)
+	return record, wrapErr(err)
+}
+
+func (s *gormStore) CreateMemory(ctx context.Context, userID int64, memory string) error {
+	return gorm.G[MemoryRecord](s.db).Create(ctx, &MemoryRecord{UserID: userID, Memory: memory})
+}
+
+func (s *gormStore) DeleteMemory(ctx context.Context, userID int64, memoryID uint) error {
+	result := s.db.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", memoryID, userID).Delete(&MemoryRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormStore) PurgeMemories(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().Where("created_at < ?", before).Delete(&MemoryRecord{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *gormStore) CreateRound(ctx context.Context, record *RoundRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	// 消息的UserID和CreatedAt与所属的轮次相同, 删除用户数据和搜索时依赖这两个字段
+	for i := range record.Messages {
+		record.Messages[i].UserID = record.UserID
+		record.Messages[i].CreatedAt = record.CreatedAt
+	}
+	return gorm.G[RoundRecord](s.db).Create(ctx, record)
+}
+
+// preloadMessages 按顺序预加载一轮对话中的消息
+func preloadMessages(db gorm.PreloadBuilder) error {
+	db.Order("seq ASC")
+	return nil
+}
+
+func (s *gormStore) ListRecentRounds(ctx context.Context, userID int64, limit int) ([]RoundRecord, error) {
+	query := gorm.G[RoundRecord](s.db).Preload("Messages", preloadMessages).Where("user_id = ?", userID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	return query.Find(ctx)
+}
+
+func (s *gormStore) ListRoundsSince(ctx context.Context, userID int64, since time.Time) ([]RoundRecord, error) {
+	return gorm.G[RoundRecord](s.db).Preload("Messages", preloadMessages).Where("user_id = ? AND created_at >= ?", userID, since).Order("created_at ASC, id ASC").Find(ctx)
+}
+
+func (s *gormStore) GetLastRound(ctx context.Context, userID int64) (RoundRecord, error) {
+	record, err := gorm.G[RoundRecord](s.db).Preload("Messages", preloadMessages).Where("user_id = ?", userID).Order("created_at DESC, id DESC").First(ctx)
+	return record, wrapErr(err)
+}
+
+func (s *gormStore) DeleteRound(ctx context.Context, userID int64, roundID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		_, err := deleteRoundsWhere(tx, "id = ? AND user_id = ?", roundID, userID)
+		return err
+	})
+}
+
+func (s *gormStore) CountRounds(ctx context.Context, userID int64) (int64, error) {
+	return gorm.G[RoundRecord](s.db).Where("user_id = ?", userID).Count(ctx, "id")
+}
+
+func (s *gormStore) PurgeRounds(ctx context.Context, before time.Time, keep int) (int64, error) {
+	var total int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		if !before.IsZero() {
+			n, err := deleteRoundsWhere(tx, "created_at < ?", before)
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+
+		if keep > 0 {
+			userIDs := []int64{}
+			err := tx.Model(&RoundRecord{}).Group("user_id").Having("COUNT(*) > ?", keep).Pluck("user_id", &userIDs).Error
+			if err != nil {
+				return err
+			}
+
+			for _, userID := range userIDs {
+				// 第keep新的一轮, 比它更早的都需要删除
+				cutoff := []RoundRecord{}
+				err := tx.Select("id", "created_at").Where("user_id = ?", userID).Order("created_at DESC, id DESC").Offset(keep - 1).Limit(1).Find(&cutoff).Error
+				if err != nil {
+					return err
+				}
+				if len(cutoff) == 0 {
+					continue
+				}
+
+				c := cutoff[0]
+				n, err := deleteRoundsWhere(tx, "user_id = ? AND (created_at < ? OR (created_at = ? AND id < ?))", userID, c.CreatedAt, c.CreatedAt, c.ID)
+				if err != nil {
+					return err
+				}
+				total += n
+			}
+		}
+
+		return nil
+	})
+	return total, err
+}
+
+// deleteRoundsWhere 删除满足条件的对话及其消息, tx需要是Unscoped的
+func deleteRoundsWhere(tx *gorm.DB, query string, args ...any) (int64, error) {
+	rounds := tx.Model(&RoundRecord{}).Select("id").Where(query, args...)
+	if err := tx.Where("round_id IN (?)", rounds).Delete(&MessageRecord{}).Error; err != nil {
+		return 0, err
+	}
+
+	result := tx.Where(query, args...).Delete(&RoundRecord{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *gormStore) SearchMessages(ctx context.Context, userID int64, query string, limit int) ([]MessageRecord, error) {
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	q := gorm.G[MessageRecord](s.db).
+		Where("user_id = ? AND role IN ? AND LOWER(content) LIKE ? ESCAPE '!'", userID, []string{roleUser, roleAssistant}, pattern).
+		Order("created_at DESC, id DESC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	return q.Find(ctx)
+}
+
+// escapeLike 以!为转义符转义LIKE中的通配符, 避免不同数据库对反斜杠的处理差异
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+func (s *gormStore) AddUsage(ctx context.Context, delta UsageRecord) error {
+	res := s.db.WithContext(ctx).Model(&UsageRecord{}).
+		Where("user_id = ? AND day = ? AND model_name = ?", delta.UserID, delta.Day, delta.ModelName).
+		Updates(map[string]any{
+			"rounds":            gorm.Expr("rounds + ?", delta.Rounds),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", delta.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", delta.CompletionTokens),
+			"cost":              gorm.Expr("cost + ?", delta.Cost),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	return gorm.G[UsageRecord](s.db).Create(ctx, &delta)
+}
+
+func (s *gormStore) ListUsageSince(ctx context.Context, userID int64, day string) ([]UsageRecord, error) {
+	query := gorm.G[UsageRecord](s.db).Where("day >= ?", day)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	return query.Order("day ASC").Find(ctx)
+}
+
+func (s *gormStore) GetUserQuota(ctx context.Context, userID int64) (UserQuotaRecord, error) {
+	records, err := gorm.G[UserQuotaRecord](s.db).Where("user_id = ?", userID).Limit(1).Find(ctx)
+	if err != nil {
+		return UserQuotaRecord{}, err
+	}
+	if len(records) == 0 {
+		return UserQuotaRecord{UserID: userID}, nil
+	}
+	return records[0], nil
+}
+
+func (s *gormStore) SaveUserQuota(ctx context.Context, record *UserQuotaRecord) error {
+	return s.db.WithContext(ctx).Save(record).Error
+}
+
+func (s *gormStore) GetUserSettings(ctx context.Context, userID int64) (UserSettingsRecord, error) {
+	records, err := gorm.G[UserSettingsRecord](s.db).Where("user_id = ?", userID).Limit(1).Find(ctx)
+	if err != nil {
+		return UserSettingsRecord{}, err
+	}
+	if len(records) == 0 {
+		return UserSettingsRecord{UserID: userID}, nil
+	}
+	return records[0], nil
+}
+
+func (s *gormStore) SaveUserSettings(ctx context.Context, record *UserSettingsRecord) error {
+	return s.db.WithContext(ctx).Save(record).Error
+}
+
+func (s *gormStore) CreateInvite(ctx context.Context, invite *InviteRecord) error {
+	return gorm.G[InviteRecord](s.db).Create(ctx, invite)
+}
+
+func (s *gormStore) ListInvites(ctx context.Context) ([]InviteRecord, error) {
+	return gorm.G[InviteRecord](s.db).Order("id DESC").Find(ctx)
+}
+
+func (s *gormStore) RevokeInvite(ctx context.Context, code string) error {
+	n, err := gorm.G[InviteRecord](s.db).Where("code = ?", code).Update(ctx, "revoked", true)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormStore) RedeemInvite(ctx context.Context, code string, userID int64, now time.Time) (InviteRecord, error) {
+	var invite InviteRecord
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		records, err := gorm.G[InviteRecord](tx).Where("code = ?", code).Limit(1).Find(ctx)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 || !records[0].IsUsable(now) {
+			return ErrInviteUnusable
+		}
+		invite = records[0]
+
+		_, err = gorm.G[InviteRecord](tx).Where("id = ?", invite.ID).Update(ctx, "uses", invite.Uses+1)
+		if err != nil {
+			return err
+		}
+		invite.Uses++
+
+		return gorm.G[AllowedUserRecord](tx).Create(ctx, &AllowedUserRecord{UserID: userID, IsAdmin: invite.IsAdmin})
+	})
+
+	return invite, err
+}
+
+func (s *gormStore) GetLastAccessRequest(ctx context.Context, userID int64) (AccessRequestRecord, error) {
+	record, err := gorm.G[AccessRequestRecord](s.db).Where("user_id = ?", userID).Last(ctx)
+	return record, wrapErr(err)
+}
+
+func (s *gormStore) CreateAccessRequest(ctx context.Context, request *AccessRequestRecord) error {
+	return gorm.G[AccessRequestRecord](s.db).Create(ctx, request)
+}
+
+func (s *gormStore) DecideAccessRequest(ctx context.Context, requestID uint, adminID int64, approve bool) (AccessRequestRecord, error) {
+	var request AccessRequestRecord
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		request, err = gorm.G[AccessRequestRecord](tx).Where("id = ?", requestID).Last(ctx)
+		if err != nil {
+			return wrapErr(err)
+		}
+		if request.Status != AccessRequestPending {
+			return ErrAccessRequestDecided
+		}
+
+		request.Status = AccessRequestDenied
+		if approve {
+			request.Status = AccessRequestApproved
+		}
+		request.DecidedBy = adminID
+
+		_, err = gorm.G[AccessRequestRecord](tx).Where("id = ?", requestID).Updates(ctx, AccessRequestRecord{
+			Status:    request.Status,
+			DecidedBy: adminID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !approve {
+			return nil
+		}
+
+		exists, err := gorm.G[AllowedUserRecord](tx).Where("user_id = ?", request.UserID).Limit(1).Find(ctx)
+		if err != nil {
+			return err
+		}
+		if len(exists) > 0 {
+			return nil
+		}
+		return gorm.G[AllowedUserRecord](tx).Create(ctx, &AllowedUserRecord{UserID: request.UserID})
+	})
+
+	return request, err
+}
+
+func (s *gormStore) GetActiveBan(ctx context.Context, userID int64, now time.Time) (BanRecord, error) {
+	record, err := gorm.G[BanRecord](s.db).Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, now).Last(ctx)
+	return record, wrapErr(err)
+}
+
+func (s *gormStore) SaveBan(ctx context.Context, ban *BanRecord) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[BanRecord](tx).Where("user_id = ?", ban.UserID).Delete(ctx); err != nil {
+			return err
+		}
+		return gorm.G[BanRecord](tx).Create(ctx, ban)
+	})
+}
+
+func (s *gormStore) DeleteBan(ctx context.Context, userID int64) error {
+	_, err := gorm.G[BanRecord](s.db).Where("user_id = ?", userID).Delete(ctx)
+	return err
+}
+
+func (s *gormStore) ListActiveBans(ctx context.Context, now time.Time) ([]BanRecord, error) {
+	return gorm.G[BanRecord](s.db).Where("expires_at IS NULL OR expires_at > ?", now).Order("id ASC").Find(ctx)
+}
+
+func (s *gormStore) CreateReminder(ctx context.Context, reminder *ReminderRecord) error {
+	return gorm.G[ReminderRecord](s.db).Create(ctx, reminder)
+}
+
+func (s *gormStore) ListReminders(ctx context.Context, userID int64) ([]ReminderRecord, error) {
+	return gorm.G[ReminderRecord](s.db).Where("user_id = ?", userID).Order("next_at ASC").Find(ctx)
+}
+
+func (s *gormStore) DeleteReminder(ctx context.Context, userID int64, reminderID uint) error {
+	result := s.db.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", reminderID, userID).Delete(&ReminderRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormStore) ListDueReminders(ctx context.Context, now time.Time) ([]ReminderRecord, error) {
+	return gorm.G[ReminderRecord](s.db).Where("next_at <= ?", now).Order("next_at ASC").Find(ctx)
+}
+
+func (s *gormStore) UpdateReminderNext(ctx context.Context, reminderID uint, next time.Time) error {
+	_, err := gorm.G[ReminderRecord](s.db).Where("id = ?", reminderID).Update(ctx, "next_at", next)
+	return err
+}
+
+func (s *gormStore) CreateSchedule(ctx context.Context, schedule *ScheduleRecord) error {
+	return gorm.G[ScheduleRecord](s.db).Create(ctx, schedule)
+}
+
+func (s *gormStore) ListSchedules(ctx context.Context, userID int64) ([]ScheduleRecord, error) {
+	return gorm.G[ScheduleRecord](s.db).Where("user_id = ?", userID).Order("next_at ASC").Find(ctx)
+}
+
+func (s *gormStore) CountSchedules(ctx context.Context, userID int64) (int64, error) {
+	return gorm.G[ScheduleRecord](s.db).Where("user_id = ?", userID).Count(ctx, "id")
+}
+
+func (s *gormStore) DeleteSchedule(ctx context.Context, userID int64, scheduleID uint) error {
+	result := s.db.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", scheduleID, userID).Delete(&ScheduleRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormStore) ListDueSchedules(ctx context.Context, now time.Time) ([]ScheduleRecord, error) {
+	return gorm.G[ScheduleRecord](s.db).Where("next_at <= ?", now).Order("next_at ASC").Find(ctx)
+}
+
+func (s *gormStore) UpdateScheduleNext(ctx context.Context, scheduleID uint, next time.Time) error {
+	_, err := gorm.G[ScheduleRecord](s.db).Where("id = ?", scheduleID).Update(ctx, "next_at", next)
+	return err
+}
+
+func (s *gormStore) CreateAudit(ctx context.Context, record *AuditRecord) error {
+	return gorm.G[AuditRecord](s.db).Create(ctx, record)
+}
+
+func (s *gormStore) ListRecentAudits(ctx context.Context, limit int) ([]AuditRecord, error) {
+	return gorm.G[AuditRecord](s.db).Order("id DESC").Limit(limit).Find(ctx)
+}
+
+func (s *gormStore) PurgeAudits(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().Where("created_at < ?", before).Delete(&AuditRecord{})
+	return result.RowsAffected, result.Error
+}
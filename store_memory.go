@@ -0,0 +1,751 @@
+package atri
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore 是基于内存的Store实现, 进程退出后数据即丢失
+type memoryStore struct {
+	lock   sync.Mutex
+	lastID uint
+
+	users          []AllowedUserRecord
+	memories       []MemoryRecord
+	rounds         []RoundRecord
+	usages         []UsageRecord
+	quotas         []UserQuotaRecord
+	settings       []UserSettingsRecord
+	invites        []InviteRecord
+	accessRequests []AccessRequestRecord
+	audits         []AuditRecord
+	bans           []BanRecord
+	reminders      []ReminderRecord
+	schedules      []ScheduleRecord
+}
+
+// NewMemoryStore 创建一个基于内存的Store, 适用于测试和临时的Bot
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+// newModel 分配一个新的ID并填充创建时间, 调用前需要持有锁
+func (s *memoryStore) newModel() Model {
+	s.lastID++
+	now := time.Now()
+	return Model{ID: s.lastID, CreatedAt: now, UpdatedAt: now}
+}
+
+// findIndex 返回第一个满足条件的元素下标, 不存在时返回-1
+func findIndex[T any](records []T, match func(T) bool) int {
+	return slices.IndexFunc(records, match)
+}
+
+// findLastIndex 返回最后一个满足条件的元素下标, 与GORM的Last相同; 不存在时返回-1
+func findLastIndex[T any](records []T, match func(T) bool) int {
+	for i := len(records) - 1; i >= 0; i-- {
+		if match(records[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// filterRecords 返回所有满足条件的元素的拷贝
+func filterRecords[T any](records []T, match func(T) bool) []T {
+	res := []T{}
+	for _, r := range records {
+		if match(r) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// paginate 对切片进行分页
+func paginate[T any](records []T, offset int, limit int) []T {
+	if offset >= len(records) {
+		return []T{}
+	}
+	end := len(records)
+	if limit > 0 {
+		end = min(end, offset+limit)
+	}
+	return slices.Clone(records[offset:end])
+}
+
+func (s *memoryStore) Migrate(_ context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) RewriteEncryptedFields(_ context.Context, skipPrefix string, rewrite func(string) (string, error)) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fields := []*string{}
+	for i := range s.memories {
+		fields = append(fields, &s.memories[i].Memory)
+	}
+	for i := range s.rounds {
+		fields = append(fields, &s.rounds[i].InJSON)
+		for j := range s.rounds[i].Messages {
+			fields = append(fields, &s.rounds[i].Messages[j].Content, &s.rounds[i].Messages[j].ToolCalls)
+		}
+	}
+	for i := range s.reminders {
+		fields = append(fields, &s.reminders[i].Text)
+	}
+	for i := range s.schedules {
+		fields = append(fields, &s.schedules[i].Prompt)
+	}
+
+	var total int64
+	for _, field := range fields {
+		if *field == "" || strings.HasPrefix(*field, skipPrefix) {
+			continue
+		}
+		value, err := rewrite(*field)
+		if err != nil {
+			return total, err
+		}
+		*field = value
+		total++
+	}
+	return total, nil
+}
+
+func (s *memoryStore) HasAnyUser(_ context.Context) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.users) > 0, nil
+}
+
+func (s *memoryStore) GetUser(_ context.Context, userID int64) (AllowedUserRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findLastIndex(s.users, func(u AllowedUserRecord) bool { return u.UserID == userID })
+	if i < 0 {
+		return AllowedUserRecord{}, ErrNotFound
+	}
+	return s.users[i], nil
+}
+
+func (s *memoryStore) CreateUser(_ context.Context, userID int64, isAdmin bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users = append(s.users, AllowedUserRecord{Model: s.newModel(), UserID: userID, IsAdmin: isAdmin})
+	return nil
+}
+
+func (s *memoryStore) DeleteUser(_ context.Context, userID int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users = slices.DeleteFunc(s.users, func(u AllowedUserRecord) bool { return u.UserID == userID })
+	return nil
+}
+
+func (s *memoryStore) DeleteUserData(_ context.Context, userID int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rounds = slices.DeleteFunc(s.rounds, func(r RoundRecord) bool { return r.UserID == userID })
+	s.memories = slices.DeleteFunc(s.memories, func(m MemoryRecord) bool { return m.UserID == userID })
+	s.reminders = slices.DeleteFunc(s.reminders, func(r ReminderRecord) bool { return r.UserID == userID })
+	s.schedules = slices.DeleteFunc(s.schedules, func(r ScheduleRecord) bool { return r.UserID == userID })
+	s.settings = slices.DeleteFunc(s.settings, func(r UserSettingsRecord) bool { return r.UserID == userID })
+	s.accessRequests = slices.DeleteFunc(s.accessRequests, func(r AccessRequestRecord) bool { return r.UserID == userID })
+	return nil
+}
+
+func (s *memoryStore) ListUsers(_ context.Context) ([]AllowedUserRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return slices.Clone(s.users), nil
+}
+
+func (s *memoryStore) ListUsersPage(_ context.Context, offset int, limit int) ([]AllowedUserRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return paginate(s.users, offset, limit), nil
+}
+
+func (s *memoryStore) CountUsers(_ context.Context) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return int64(len(s.users)), nil
+}
+
+func (s *memoryStore) ListAdmins(_ context.Context) ([]AllowedUserRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return filterRecords(s.users, func(u AllowedUserRecord) bool { return u.IsAdmin }), nil
+}
+
+func (s *memoryStore) UpdateUserAdmin(_ context.Context, userID int64, isAdmin bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.users {
+		if s.users[i].UserID == userID {
+			s.users[i].IsAdmin = isAdmin
+			s.users[i].Role = ""
+			s.users[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateUserRole(_ context.Context, userID int64, role string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.users {
+		if s.users[i].UserID == userID {
+			s.users[i].IsAdmin = role == RoleAdmin
+			s.users[i].Role = role
+			s.users[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListMemories(_ context.Context, userID int64) ([]MemoryRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return filterRecords(s.memories, func(m MemoryRecord) bool { return m.UserID == userID }), nil
+}
+
+func (s *memoryStore) ListMemoriesPage(_ context.Context, userID int64, offset int, limit int) ([]MemoryRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return paginate(filterRecords(s.memories, func(m MemoryRecord) bool { return m.UserID == userID }), offset, limit), nil
+}
+
+func (s *memoryStore) CountMemories(_ context.Context, userID int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return int64(len(filterRecords(s.memories, func(m MemoryRecord) bool { return m.UserID == userID }))), nil
+}
+
+func (s *memoryStore) GetMemory(_ context.Context, userID int64, memoryID uint) (MemoryRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.memories, func(m MemoryRecord) bool { return m.ID == memoryID && m.UserID == userID })
+	if i < 0 {
+		return MemoryRecord{}, ErrNotFound
+	}
+	return s.memories[i], nil
+}
+
+func (s *memoryStore) CreateMemory(_ context.Context, userID int64, memory string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.memories = append(s.memories, MemoryRecord{Model: s.newModel(), UserID: userID, Memory: memory})
+	return nil
+}
+
+func (s *memoryStore) DeleteMemory(_ context.Context, userID int64, memoryID uint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	before := len(s.memories)
+	s.memories = slices.DeleteFunc(s.memories, func(m MemoryRecord) bool { return m.ID == memoryID && m.UserID == userID })
+	if len(s.memories) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *memoryStore) PurgeMemories(_ context.Context, before time.Time) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n := len(s.memories)
+	s.memories = slices.DeleteFunc(s.memories, func(m MemoryRecord) bool { return m.CreatedAt.Before(before) })
+	return int64(n - len(s.memories)), nil
+}
+
+func (s *memoryStore) CreateRound(_ context.Context, record *RoundRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	createdAt := record.CreatedAt
+	record.Model = s.newModel()
+	if !createdAt.IsZero() {
+		record.CreatedAt = createdAt
+	}
+	for i := range record.Messages {
+		record.Messages[i].Model = s.newModel()
+		record.Messages[i].CreatedAt = record.CreatedAt
+		record.Messages[i].RoundID = record.ID
+		record.Messages[i].UserID = record.UserID
+	}
+	stored := *record
+	stored.Messages = slices.Clone(record.Messages)
+
+	// s.rounds按创建时间排序, 创建时间相同时按ID排序
+	i := len(s.rounds)
+	for i > 0 && s.rounds[i-1].CreatedAt.After(stored.CreatedAt) {
+		i--
+	}
+	s.rounds = slices.Insert(s.rounds, i, stored)
+	return nil
+}
+
+func (s *memoryStore) ListRecentRounds(_ context.Context, userID int64, limit int) ([]RoundRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rounds := filterRecords(s.rounds, func(r RoundRecord) bool { return r.UserID == userID })
+	slices.Reverse(rounds)
+	return paginate(rounds, 0, limit), nil
+}
+
+func (s *memoryStore) ListRoundsSince(_ context.Context, userID int64, since time.Time) ([]RoundRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return filterRecords(s.rounds, func(r RoundRecord) bool { return r.UserID == userID && !r.CreatedAt.Before(since) }), nil
+}
+
+func (s *memoryStore) GetLastRound(_ context.Context, userID int64) (RoundRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := len(s.rounds) - 1; i >= 0; i-- {
+		if s.rounds[i].UserID == userID {
+			return s.rounds[i], nil
+		}
+	}
+	return RoundRecord{}, ErrNotFound
+}
+
+func (s *memoryStore) DeleteRound(_ context.Context, userID int64, roundID uint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rounds = slices.DeleteFunc(s.rounds, func(r RoundRecord) bool { return r.ID == roundID && r.UserID == userID })
+	return nil
+}
+
+func (s *memoryStore) CountRounds(_ context.Context, userID int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return int64(len(filterRecords(s.rounds, func(r RoundRecord) bool { return r.UserID == userID }))), nil
+}
+
+func (s *memoryStore) PurgeRounds(_ context.Context, before time.Time, keep int) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// 从新到旧统计每个用户已保留的轮数
+	kept := map[int64]int{}
+	expired := map[uint]bool{}
+	for i := len(s.rounds) - 1; i >= 0; i-- {
+		r := s.rounds[i]
+		kept[r.UserID]++
+		if r.CreatedAt.Before(before) || (keep > 0 && kept[r.UserID] > keep) {
+			expired[r.ID] = true
+		}
+	}
+
+	s.rounds = slices.DeleteFunc(s.rounds, func(r RoundRecord) bool { return expired[r.ID] })
+	return int64(len(expired)), nil
+}
+
+func (s *memoryStore) SearchMessages(_ context.Context, userID int64, query string, limit int) ([]MessageRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	query = strings.ToLower(query)
+	results := []MessageRecord{}
+	for i := len(s.rounds) - 1; i >= 0; i-- {
+		round := s.rounds[i]
+		if round.UserID != userID {
+			continue
+		}
+		for j := len(round.Messages) - 1; j >= 0; j-- {
+			m := round.Messages[j]
+			if (m.Role == roleUser || m.Role == roleAssistant) && strings.Contains(strings.ToLower(m.Content), query) {
+				results = append(results, m)
+			}
+		}
+	}
+	return paginate(results, 0, limit), nil
+}
+
+func (s *memoryStore) AddUsage(_ context.Context, delta UsageRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.usages, func(u UsageRecord) bool {
+		return u.UserID == delta.UserID && u.Day == delta.Day && u.ModelName == delta.ModelName
+	})
+	if i < 0 {
+		delta.Model = s.newModel()
+		s.usages = append(s.usages, delta)
+		return nil
+	}
+
+	u := &s.usages[i]
+	u.Rounds += delta.Rounds
+	u.PromptTokens += delta.PromptTokens
+	u.CompletionTokens += delta.CompletionTokens
+	u.Cost += delta.Cost
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memoryStore) ListUsageSince(_ context.Context, userID int64, day string) ([]UsageRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := filterRecords(s.usages, func(u UsageRecord) bool {
+		return u.Day >= day && (userID == 0 || u.UserID == userID)
+	})
+	slices.SortStableFunc(res, func(a, b UsageRecord) int { return cmp.Compare(a.Day, b.Day) })
+	return res, nil
+}
+
+func (s *memoryStore) GetUserQuota(_ context.Context, userID int64) (UserQuotaRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.quotas, func(q UserQuotaRecord) bool { return q.UserID == userID })
+	if i < 0 {
+		return UserQuotaRecord{UserID: userID}, nil
+	}
+	return s.quotas[i], nil
+}
+
+func (s *memoryStore) SaveUserQuota(_ context.Context, record *UserQuotaRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.quotas, func(q UserQuotaRecord) bool { return q.UserID == record.UserID })
+	if i < 0 {
+		record.Model = s.newModel()
+		s.quotas = append(s.quotas, *record)
+		return nil
+	}
+
+	record.Model = s.quotas[i].Model
+	record.UpdatedAt = time.Now()
+	s.quotas[i] = *record
+	return nil
+}
+
+func (s *memoryStore) GetUserSettings(_ context.Context, userID int64) (UserSettingsRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.settings, func(r UserSettingsRecord) bool { return r.UserID == userID })
+	if i < 0 {
+		return UserSettingsRecord{UserID: userID}, nil
+	}
+	return s.settings[i], nil
+}
+
+func (s *memoryStore) SaveUserSettings(_ context.Context, record *UserSettingsRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.settings, func(r UserSettingsRecord) bool { return r.UserID == record.UserID })
+	if i < 0 {
+		record.Model = s.newModel()
+		s.settings = append(s.settings, *record)
+		return nil
+	}
+
+	record.Model = s.settings[i].Model
+	record.UpdatedAt = time.Now()
+	s.settings[i] = *record
+	return nil
+}
+
+func (s *memoryStore) CreateInvite(_ context.Context, invite *InviteRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	invite.Model = s.newModel()
+	s.invites = append(s.invites, *invite)
+	return nil
+}
+
+func (s *memoryStore) ListInvites(_ context.Context) ([]InviteRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := slices.Clone(s.invites)
+	slices.Reverse(res)
+	return res, nil
+}
+
+func (s *memoryStore) RevokeInvite(_ context.Context, code string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.invites, func(inv InviteRecord) bool { return inv.Code == code })
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.invites[i].Revoked = true
+	return nil
+}
+
+func (s *memoryStore) RedeemInvite(_ context.Context, code string, userID int64, now time.Time) (InviteRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.invites, func(inv InviteRecord) bool { return inv.Code == code })
+	if i < 0 || !s.invites[i].IsUsable(now) {
+		return InviteRecord{}, ErrInviteUnusable
+	}
+
+	s.invites[i].Uses++
+	s.users = append(s.users, AllowedUserRecord{Model: s.newModel(), UserID: userID, IsAdmin: s.invites[i].IsAdmin})
+	return s.invites[i], nil
+}
+
+func (s *memoryStore) GetLastAccessRequest(_ context.Context, userID int64) (AccessRequestRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findLastIndex(s.accessRequests, func(r AccessRequestRecord) bool { return r.UserID == userID })
+	if i < 0 {
+		return AccessRequestRecord{}, ErrNotFound
+	}
+	return s.accessRequests[i], nil
+}
+
+func (s *memoryStore) CreateAccessRequest(_ context.Context, request *AccessRequestRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	request.Model = s.newModel()
+	s.accessRequests = append(s.accessRequests, *request)
+	return nil
+}
+
+func (s *memoryStore) DecideAccessRequest(_ context.Context, requestID uint, adminID int64, approve bool) (AccessRequestRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findIndex(s.accessRequests, func(r AccessRequestRecord) bool { return r.ID == requestID })
+	if i < 0 {
+		return AccessRequestRecord{}, ErrNotFound
+	}
+	request := &s.accessRequests[i]
+	if request.Status != AccessRequestPending {
+		return *request, ErrAccessRequestDecided
+	}
+
+	request.Status = AccessRequestDenied
+	if approve {
+		request.Status = AccessRequestApproved
+	}
+	request.DecidedBy = adminID
+	request.UpdatedAt = time.Now()
+
+	if approve && findIndex(s.users, func(u AllowedUserRecord) bool { return u.UserID == request.UserID }) < 0 {
+		s.users = append(s.users, AllowedUserRecord{Model: s.newModel(), UserID: request.UserID})
+	}
+
+	return *request, nil
+}
+
+func (s *memoryStore) GetActiveBan(_ context.Context, userID int64, now time.Time) (BanRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := findLastIndex(s.bans, func(b BanRecord) bool { return b.UserID == userID && b.IsActive(now) })
+	if i < 0 {
+		return BanRecord{}, ErrNotFound
+	}
+	return s.bans[i], nil
+}
+
+func (s *memoryStore) SaveBan(_ context.Context, ban *BanRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bans = slices.DeleteFunc(s.bans, func(b BanRecord) bool { return b.UserID == ban.UserID })
+	ban.Model = s.newModel()
+	s.bans = append(s.bans, *ban)
+	return nil
+}
+
+func (s *memoryStore) DeleteBan(_ context.Context, userID int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bans = slices.DeleteFunc(s.bans, func(b BanRecord) bool { return b.UserID == userID })
+	return nil
+}
+
+func (s *memoryStore) ListActiveBans(_ context.Context, now time.Time) ([]BanRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return filterRecords(s.bans, func(b BanRecord) bool { return b.IsActive(now) }), nil
+}
+
+func (s *memoryStore) CreateReminder(_ context.Context, reminder *ReminderRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	reminder.Model = s.newModel()
+	s.reminders = append(s.reminders, *reminder)
+	return nil
+}
+
+// sortReminders 按提醒时间从早到晚排序
+func sortReminders(reminders []ReminderRecord) []ReminderRecord {
+	slices.SortStableFunc(reminders, func(a, b ReminderRecord) int { return a.NextAt.Compare(b.NextAt) })
+	return reminders
+}
+
+func (s *memoryStore) ListReminders(_ context.Context, userID int64) ([]ReminderRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortReminders(filterRecords(s.reminders, func(r ReminderRecord) bool { return r.UserID == userID })), nil
+}
+
+func (s *memoryStore) DeleteReminder(_ context.Context, userID int64, reminderID uint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	before := len(s.reminders)
+	s.reminders = slices.DeleteFunc(s.reminders, func(r ReminderRecord) bool { return r.ID == reminderID && r.UserID == userID })
+	if len(s.reminders) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *memoryStore) ListDueReminders(_ context.Context, now time.Time) ([]ReminderRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortReminders(filterRecords(s.reminders, func(r ReminderRecord) bool { return !r.NextAt.After(now) })), nil
+}
+
+func (s *memoryStore) UpdateReminderNext(_ context.Context, reminderID uint, next time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.reminders {
+		if s.reminders[i].ID == reminderID {
+			s.reminders[i].NextAt = next
+			s.reminders[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateSchedule(_ context.Context, schedule *ScheduleRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	schedule.Model = s.newModel()
+	s.schedules = append(s.schedules, *schedule)
+	return nil
+}
+
+// sortSchedules 按下一次执行的时间从早到晚排序
+func sortSchedules(schedules []ScheduleRecord) []ScheduleRecord {
+	slices.SortStableFunc(schedules, func(a, b ScheduleRecord) int { return a.NextAt.Compare(b.NextAt) })
+	return schedules
+}
+
+func (s *memoryStore) ListSchedules(_ context.Context, userID int64) ([]ScheduleRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortSchedules(filterRecords(s.schedules, func(r ScheduleRecord) bool { return r.UserID == userID })), nil
+}
+
+func (s *memoryStore) CountSchedules(_ context.Context, userID int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return int64(len(filterRecords(s.schedules, func(r ScheduleRecord) bool { return r.UserID == userID }))), nil
+}
+
+func (s *memoryStore) DeleteSchedule(_ context.Context, userID int64, scheduleID uint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	before := len(s.schedules)
+	s.schedules = slices.DeleteFunc(s.schedules, func(r ScheduleRecord) bool { return r.ID == scheduleID && r.UserID == userID })
+	if len(s.schedules) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *memoryStore) ListDueSchedules(_ context.Context, now time.Time) ([]ScheduleRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortSchedules(filterRecords(s.schedules, func(r ScheduleRecord) bool { return !r.NextAt.After(now) })), nil
+}
+
+func (s *memoryStore) UpdateScheduleNext(_ context.Context, scheduleID uint, next time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.schedules {
+		if s.schedules[i].ID == scheduleID {
+			s.schedules[i].NextAt = next
+			s.schedules[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateAudit(_ context.Context, record *AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record.Model = s.newModel()
+	s.audits = append(s.audits, *record)
+	return nil
+}
+
+func (s *memoryStore) ListRecentAudits(_ context.Context, limit int) ([]AuditRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	audits := slices.Clone(s.audits)
+	slices.Reverse(audits)
+	return paginate(audits, 0, limit), nil
+}
+
+func (s *memoryStore) PurgeAudits(_ context.Context, before time.Time) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n := len(s.audits)
+	s.audits = slices.DeleteFunc(s.audits, func(r AuditRecord) bool { return r.CreatedAt.Before(before) })
+	return int64(n - len(s.audits)), nil
+}
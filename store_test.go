@@ -0,0 +1,600 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testStores 是契约测试覆盖的Store实现, 每个测试都使用新的空Store
+var testStores = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(*testing.T) Store { return NewMemoryStore() }},
+	{"gorm", openTestGormStore},
+}
+
+// openTestGormStore 打开一个基于内存SQLite的GormStore
+func openTestGormStore(t *testing.T) Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个连接都是独立的内存数据库, 只使用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return NewGormStore(db)
+}
+
+// forEachStore 对每个Store实现运行同一个测试
+func forEachStore(t *testing.T, test func(t *testing.T, ctx context.Context, s Store)) {
+	for _, ts := range testStores {
+		t.Run(ts.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := ts.open(t)
+			if err := s.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			test(t, ctx, s)
+		})
+	}
+}
+
+func must[T any](t *testing.T) func(T, error) T {
+	return func(v T, err error) T {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func roundIDs(rounds []RoundRecord) []uint {
+	ids := []uint{}
+	for _, r := range rounds {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func newTestRound(userID int64, createdAt time.Time, contents ...string) *RoundRecord {
+	round := &RoundRecord{UserID: userID}
+	round.CreatedAt = createdAt
+	for i, content := range contents {
+		role := roleUser
+		if i%2 == 1 {
+			role = roleAssistant
+		}
+		round.Messages = append(round.Messages, MessageRecord{Seq: i, Role: role, Content: content})
+	}
+	return round
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		if must[bool](t)(s.HasAnyUser(ctx)) {
+			t.Fatal("new store has users")
+		}
+		if _, err := s.GetUser(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetUser on empty store: err = %v, want ErrNotFound", err)
+		}
+
+		check(t, s.CreateUser(ctx, 1, false))
+		check(t, s.CreateUser(ctx, 1, true))
+		check(t, s.CreateUser(ctx, 2, false))
+
+		// 同一用户有多条记录时返回最新的一条
+		if user := must[AllowedUserRecord](t)(s.GetUser(ctx, 1)); !user.IsAdmin {
+			t.Fatal("GetUser did not return the latest record")
+		}
+		if n := must[int64](t)(s.CountUsers(ctx)); n != 3 {
+			t.Fatalf("CountUsers = %d, want 3", n)
+		}
+		if page := must[[]AllowedUserRecord](t)(s.ListUsersPage(ctx, 2, 10)); len(page) != 1 || page[0].UserID != 2 {
+			t.Fatalf("ListUsersPage(2, 10) = %+v", page)
+		}
+
+		check(t, s.UpdateUserRole(ctx, 2, RoleAdmin))
+		if admins := must[[]AllowedUserRecord](t)(s.ListAdmins(ctx)); len(admins) != 2 {
+			t.Fatalf("ListAdmins returned %d users, want 2", len(admins))
+		}
+		check(t, s.UpdateUserAdmin(ctx, 2, false))
+		if user := must[AllowedUserRecord](t)(s.GetUser(ctx, 2)); user.IsAdmin || user.Role != "" {
+			t.Fatalf("UpdateUserAdmin did not clear the role: %+v", user)
+		}
+
+		check(t, s.DeleteUser(ctx, 1))
+		if _, err := s.GetUser(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetUser after DeleteUser: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreMemories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		for _, m := range []string{"a", "b", "c"} {
+			check(t, s.CreateMemory(ctx, 1, m))
+		}
+		check(t, s.CreateMemory(ctx, 2, "other"))
+
+		memories := must[[]MemoryRecord](t)(s.ListMemories(ctx, 1))
+		if len(memories) != 3 {
+			t.Fatalf("ListMemories returned %d memories, want 3", len(memories))
+		}
+		if page := must[[]MemoryRecord](t)(s.ListMemoriesPage(ctx, 1, 1, 1)); len(page) != 1 || page[0].Memory != "b" {
+			t.Fatalf("ListMemoriesPage(1, 1) = %+v", page)
+		}
+		if n := must[int64](t)(s.CountMemories(ctx, 1)); n != 3 {
+			t.Fatalf("CountMemories = %d, want 3", n)
+		}
+
+		first := memories[0]
+		if got := must[MemoryRecord](t)(s.GetMemory(ctx, 1, first.ID)); got.Memory != "a" {
+			t.Fatalf("GetMemory = %q, want a", got.Memory)
+		}
+		if _, err := s.GetMemory(ctx, 2, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetMemory of another user: err = %v, want ErrNotFound", err)
+		}
+		if err := s.DeleteMemory(ctx, 2, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("DeleteMemory of another user: err = %v, want ErrNotFound", err)
+		}
+		check(t, s.DeleteMemory(ctx, 1, first.ID))
+		if n := must[int64](t)(s.CountMemories(ctx, 1)); n != 2 {
+			t.Fatalf("CountMemories after delete = %d, want 2", n)
+		}
+
+		if n := must[int64](t)(s.PurgeMemories(ctx, time.Now().Add(time.Minute))); n != 3 {
+			t.Fatalf("PurgeMemories = %d, want 3", n)
+		}
+	})
+}
+
+func TestStoreRoundOrdering(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		older := newTestRound(1, now.Add(-time.Hour), "older", "answer")
+		latest := newTestRound(1, time.Time{}, "latest", "answer")
+		imported := newTestRound(1, now.Add(-2*time.Hour), "imported", "answer")
+		for _, r := range []*RoundRecord{older, latest, imported} {
+			check(t, s.CreateRound(ctx, r))
+		}
+		check(t, s.CreateRound(ctx, newTestRound(2, time.Time{}, "other user")))
+
+		// 导入的对话虽然ID最大, 但按创建时间排在最前面
+		rounds := must[[]RoundRecord](t)(s.ListRecentRounds(ctx, 1, 0))
+		if want := []uint{latest.ID, older.ID, imported.ID}; !slices.Equal(roundIDs(rounds), want) {
+			t.Fatalf("ListRecentRounds = %v, want %v", roundIDs(rounds), want)
+		}
+		if limited := must[[]RoundRecord](t)(s.ListRecentRounds(ctx, 1, 2)); len(limited) != 2 {
+			t.Fatalf("ListRecentRounds(2) returned %d rounds", len(limited))
+		}
+
+		last := must[RoundRecord](t)(s.GetLastRound(ctx, 1))
+		if last.ID != latest.ID {
+			t.Fatalf("GetLastRound = %d, want %d", last.ID, latest.ID)
+		}
+		if len(last.Messages) != 2 || last.Messages[0].Content != "latest" || last.Messages[1].Role != roleAssistant {
+			t.Fatalf("GetLastRound messages = %+v", last.Messages)
+		}
+		for _, m := range last.Messages {
+			if m.UserID != 1 || m.RoundID != last.ID || !m.CreatedAt.Equal(last.CreatedAt) {
+				t.Fatalf("message does not match its round: %+v", m)
+			}
+		}
+
+		since := must[[]RoundRecord](t)(s.ListRoundsSince(ctx, 1, now.Add(-90*time.Minute)))
+		if want := []uint{older.ID, latest.ID}; !slices.Equal(roundIDs(since), want) {
+			t.Fatalf("ListRoundsSince = %v, want %v", roundIDs(since), want)
+		}
+
+		check(t, s.DeleteRound(ctx, 2, latest.ID))
+		if n := must[int64](t)(s.CountRounds(ctx, 1)); n != 3 {
+			t.Fatal("DeleteRound deleted a round of another user")
+		}
+		check(t, s.DeleteRound(ctx, 1, latest.ID))
+		if last := must[RoundRecord](t)(s.GetLastRound(ctx, 1)); last.ID != older.ID {
+			t.Fatalf("GetLastRound after delete = %d, want %d", last.ID, older.ID)
+		}
+		if _, err := s.GetLastRound(ctx, 3); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetLastRound without rounds: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStorePurgeRounds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		rounds := []*RoundRecord{
+			newTestRound(1, now.Add(-3*time.Hour), "1"),
+			newTestRound(1, now.Add(-time.Minute), "3"),
+			newTestRound(1, now.Add(-2*time.Hour), "2"),
+			newTestRound(2, now.Add(-3*time.Hour), "other"),
+		}
+		for _, r := range rounds {
+			check(t, s.CreateRound(ctx, r))
+		}
+
+		// 每个用户保留最近的2轮
+		if n := must[int64](t)(s.PurgeRounds(ctx, time.Time{}, 2)); n != 1 {
+			t.Fatalf("PurgeRounds(keep=2) = %d, want 1", n)
+		}
+		remaining := must[[]RoundRecord](t)(s.ListRecentRounds(ctx, 1, 0))
+		if want := []uint{rounds[1].ID, rounds[2].ID}; !slices.Equal(roundIDs(remaining), want) {
+			t.Fatalf("rounds after PurgeRounds(keep=2) = %v, want %v", roundIDs(remaining), want)
+		}
+
+		if n := must[int64](t)(s.PurgeRounds(ctx, now.Add(-time.Hour), 0)); n != 2 {
+			t.Fatalf("PurgeRounds(before) = %d, want 2", n)
+		}
+		if n := must[int64](t)(s.CountRounds(ctx, 2)); n != 0 {
+			t.Fatal("PurgeRounds(before) kept an expired round")
+		}
+		if results := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "2", 0)); len(results) != 0 {
+			t.Fatal("PurgeRounds kept the messages of a deleted round")
+		}
+	})
+}
+
+func TestStoreSearchMessages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		check(t, s.CreateRound(ctx, newTestRound(1, now.Add(-time.Hour), "Cat food", "cats like fish")))
+		check(t, s.CreateRound(ctx, newTestRound(1, now.Add(-2*time.Hour), "imported cat", "50% off")))
+		check(t, s.CreateRound(ctx, newTestRound(2, now, "cat of another user")))
+		tool := newTestRound(1, now, "no match")
+		tool.Messages = append(tool.Messages, MessageRecord{Seq: 1, Role: roleTool, Content: "cat", ToolCallID: "call"})
+		check(t, s.CreateRound(ctx, tool))
+
+		results := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "CAT", 0))
+		contents := []string{}
+		for _, m := range results {
+			contents = append(contents, m.Content)
+		}
+		if want := []string{"cats like fish", "Cat food", "imported cat"}; !slices.Equal(contents, want) {
+			t.Fatalf("SearchMessages = %q, want %q", contents, want)
+		}
+
+		if limited := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "cat", 1)); len(limited) != 1 {
+			t.Fatalf("SearchMessages(limit=1) returned %d messages", len(limited))
+		}
+		if results := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "0%", 0)); len(results) != 1 {
+			t.Fatalf("SearchMessages(%q) returned %d messages, want 1", "0%", len(results))
+		}
+		if results := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "t_f", 0)); len(results) != 0 {
+			t.Fatal("SearchMessages treated _ as a wildcard")
+		}
+	})
+}
+
+func TestStoreDeleteUserData(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		for _, userID := range []int64{1, 2} {
+			check(t, s.CreateUser(ctx, userID, false))
+			check(t, s.CreateMemory(ctx, userID, "memory"))
+			check(t, s.CreateRound(ctx, newTestRound(userID, time.Time{}, "hello")))
+			check(t, s.CreateReminder(ctx, &ReminderRecord{UserID: userID, Text: "reminder", NextAt: time.Now()}))
+			check(t, s.CreateSchedule(ctx, &ScheduleRecord{UserID: userID, Spec: "@daily", Prompt: "prompt", NextAt: time.Now()}))
+			check(t, s.SaveUserSettings(ctx, &UserSettingsRecord{UserID: userID, Timezone: "Asia/Shanghai"}))
+			check(t, s.CreateAccessRequest(ctx, &AccessRequestRecord{UserID: userID, ChatID: userID, Username: "someone", Status: "pending"}))
+		}
+
+		check(t, s.DeleteUserData(ctx, 1))
+
+		if n := must[int64](t)(s.CountRounds(ctx, 1)); n != 0 {
+			t.Fatal("DeleteUserData kept rounds")
+		}
+		if results := must[[]MessageRecord](t)(s.SearchMessages(ctx, 1, "hello", 0)); len(results) != 0 {
+			t.Fatal("DeleteUserData kept messages")
+		}
+		if n := must[int64](t)(s.CountMemories(ctx, 1)); n != 0 {
+			t.Fatal("DeleteUserData kept memories")
+		}
+		if reminders := must[[]ReminderRecord](t)(s.ListReminders(ctx, 1)); len(reminders) != 0 {
+			t.Fatal("DeleteUserData kept reminders")
+		}
+		if n := must[int64](t)(s.CountSchedules(ctx, 1)); n != 0 {
+			t.Fatal("DeleteUserData kept schedules")
+		}
+		if settings := must[UserSettingsRecord](t)(s.GetUserSettings(ctx, 1)); settings.Timezone != "" {
+			t.Fatal("DeleteUserData kept settings")
+		}
+		if _, err := s.GetLastAccessRequest(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("DeleteUserData kept access requests: %v", err)
+		}
+		if _, err := s.GetUser(ctx, 1); err != nil {
+			t.Fatalf("DeleteUserData removed the allowlist record: %v", err)
+		}
+
+		if n := must[int64](t)(s.CountRounds(ctx, 2)); n != 1 {
+			t.Fatal("DeleteUserData deleted rounds of another user")
+		}
+		if n := must[int64](t)(s.CountMemories(ctx, 2)); n != 1 {
+			t.Fatal("DeleteUserData deleted memories of another user")
+		}
+		if settings := must[UserSettingsRecord](t)(s.GetUserSettings(ctx, 2)); settings.Timezone == "" {
+			t.Fatal("DeleteUserData deleted settings of another user")
+		}
+	})
+}
+
+func TestStoreUsage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		check(t, s.AddUsage(ctx, UsageRecord{UserID: 1, Day: "2025-01-02", ModelName: "m", Rounds: 1, PromptTokens: 10, Cost: 0.5}))
+		check(t, s.AddUsage(ctx, UsageRecord{UserID: 1, Day: "2025-01-02", ModelName: "m", Rounds: 1, CompletionTokens: 5, Cost: 0.25}))
+		check(t, s.AddUsage(ctx, UsageRecord{UserID: 1, Day: "2025-01-01", ModelName: "m", Rounds: 1}))
+		check(t, s.AddUsage(ctx, UsageRecord{UserID: 2, Day: "2025-01-03", ModelName: "m", Rounds: 1}))
+
+		usages := must[[]UsageRecord](t)(s.ListUsageSince(ctx, 1, "2025-01-01"))
+		if len(usages) != 2 || usages[0].Day != "2025-01-01" {
+			t.Fatalf("ListUsageSince = %+v", usages)
+		}
+		u := usages[1]
+		if u.Rounds != 2 || u.PromptTokens != 10 || u.CompletionTokens != 5 || u.Cost != 0.75 {
+			t.Fatalf("AddUsage did not accumulate: %+v", u)
+		}
+
+		if all := must[[]UsageRecord](t)(s.ListUsageSince(ctx, 0, "2025-01-02")); len(all) != 2 {
+			t.Fatalf("ListUsageSince for all users returned %d records, want 2", len(all))
+		}
+	})
+}
+
+func TestStoreQuotaAndSettings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		quota := must[UserQuotaRecord](t)(s.GetUserQuota(ctx, 1))
+		if quota.UserID != 1 || quota.MessagesPerMinute != nil {
+			t.Fatalf("default quota = %+v", quota)
+		}
+		rpm := 5
+		quota.MessagesPerMinute = &rpm
+		check(t, s.SaveUserQuota(ctx, &quota))
+		rpm = 7
+		quota.MessagesPerMinute = &rpm
+		check(t, s.SaveUserQuota(ctx, &quota))
+		if got := must[UserQuotaRecord](t)(s.GetUserQuota(ctx, 1)); got.MessagesPerMinute == nil || *got.MessagesPerMinute != 7 {
+			t.Fatalf("GetUserQuota after save = %+v", got)
+		}
+
+		settings := must[UserSettingsRecord](t)(s.GetUserSettings(ctx, 1))
+		if settings.UserID != 1 || settings.Timezone != "" {
+			t.Fatalf("default settings = %+v", settings)
+		}
+		settings.Timezone = "Asia/Shanghai"
+		check(t, s.SaveUserSettings(ctx, &settings))
+		settings.Language = "en"
+		check(t, s.SaveUserSettings(ctx, &settings))
+		if got := must[UserSettingsRecord](t)(s.GetUserSettings(ctx, 1)); got.Timezone != "Asia/Shanghai" || got.Language != "en" {
+			t.Fatalf("GetUserSettings after save = %+v", got)
+		}
+	})
+}
+
+func TestStoreInvites(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		expired := now.Add(-time.Minute)
+		check(t, s.CreateInvite(ctx, &InviteRecord{Code: "once", MaxUses: 1}))
+		check(t, s.CreateInvite(ctx, &InviteRecord{Code: "expired", MaxUses: 1, ExpiresAt: &expired}))
+
+		if invites := must[[]InviteRecord](t)(s.ListInvites(ctx)); len(invites) != 2 || invites[0].Code != "expired" {
+			t.Fatalf("ListInvites = %+v, want newest first", invites)
+		}
+
+		invite := must[InviteRecord](t)(s.RedeemInvite(ctx, "once", 1, now))
+		if invite.Uses != 1 {
+			t.Fatalf("RedeemInvite returned Uses = %d, want 1", invite.Uses)
+		}
+		if _, err := s.GetUser(ctx, 1); err != nil {
+			t.Fatalf("RedeemInvite did not add the user: %v", err)
+		}
+		for _, code := range []string{"once", "expired", "missing"} {
+			if _, err := s.RedeemInvite(ctx, code, 2, now); !errors.Is(err, ErrInviteUnusable) {
+				t.Fatalf("RedeemInvite(%q): err = %v, want ErrInviteUnusable", code, err)
+			}
+		}
+
+		if err := s.RevokeInvite(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("RevokeInvite of a missing code: err = %v, want ErrNotFound", err)
+		}
+		check(t, s.RevokeInvite(ctx, "once"))
+	})
+}
+
+func TestStoreAccessRequests(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		if _, err := s.GetLastAccessRequest(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetLastAccessRequest without requests: err = %v, want ErrNotFound", err)
+		}
+
+		denied := &AccessRequestRecord{UserID: 1, ChatID: 1, Status: AccessRequestPending}
+		check(t, s.CreateAccessRequest(ctx, denied))
+		if got := must[AccessRequestRecord](t)(s.DecideAccessRequest(ctx, denied.ID, 9, false)); got.Status != AccessRequestDenied || got.DecidedBy != 9 {
+			t.Fatalf("DecideAccessRequest(deny) = %+v", got)
+		}
+		if _, err := s.GetUser(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatal("denying a request added the user")
+		}
+
+		request := &AccessRequestRecord{UserID: 1, ChatID: 1, Status: AccessRequestPending}
+		check(t, s.CreateAccessRequest(ctx, request))
+		if last := must[AccessRequestRecord](t)(s.GetLastAccessRequest(ctx, 1)); last.ID != request.ID || last.Status != AccessRequestPending {
+			t.Fatalf("GetLastAccessRequest = %+v, want the pending request", last)
+		}
+
+		if got := must[AccessRequestRecord](t)(s.DecideAccessRequest(ctx, request.ID, 9, true)); got.Status != AccessRequestApproved {
+			t.Fatalf("DecideAccessRequest(approve) = %+v", got)
+		}
+		if _, err := s.GetUser(ctx, 1); err != nil {
+			t.Fatalf("approving a request did not add the user: %v", err)
+		}
+		if _, err := s.DecideAccessRequest(ctx, request.ID, 9, false); !errors.Is(err, ErrAccessRequestDecided) {
+			t.Fatalf("deciding twice: err = %v, want ErrAccessRequestDecided", err)
+		}
+		if _, err := s.DecideAccessRequest(ctx, request.ID+100, 9, true); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("deciding a missing request: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreBans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+		check(t, s.SaveBan(ctx, &BanRecord{UserID: 1, Reason: "first", ExpiresAt: &future}))
+		check(t, s.SaveBan(ctx, &BanRecord{UserID: 1, Reason: "second"}))
+		check(t, s.SaveBan(ctx, &BanRecord{UserID: 2, ExpiresAt: &past}))
+
+		if ban := must[BanRecord](t)(s.GetActiveBan(ctx, 1, now)); ban.Reason != "second" || ban.ExpiresAt != nil {
+			t.Fatalf("SaveBan did not replace the old ban: %+v", ban)
+		}
+		if _, err := s.GetActiveBan(ctx, 2, now); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetActiveBan of an expired ban: err = %v, want ErrNotFound", err)
+		}
+		if bans := must[[]BanRecord](t)(s.ListActiveBans(ctx, now)); len(bans) != 1 || bans[0].UserID != 1 {
+			t.Fatalf("ListActiveBans = %+v", bans)
+		}
+
+		check(t, s.DeleteBan(ctx, 1))
+		if _, err := s.GetActiveBan(ctx, 1, now); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetActiveBan after DeleteBan: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreReminders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		later := &ReminderRecord{UserID: 1, Text: "later", NextAt: now.Add(time.Hour)}
+		due := &ReminderRecord{UserID: 1, Text: "due", NextAt: now.Add(-time.Minute)}
+		other := &ReminderRecord{UserID: 2, Text: "other", NextAt: now.Add(-time.Hour)}
+		for _, r := range []*ReminderRecord{later, due, other} {
+			check(t, s.CreateReminder(ctx, r))
+		}
+
+		if reminders := must[[]ReminderRecord](t)(s.ListReminders(ctx, 1)); len(reminders) != 2 || reminders[0].ID != due.ID {
+			t.Fatalf("ListReminders = %+v, want sorted by NextAt", reminders)
+		}
+		dueList := must[[]ReminderRecord](t)(s.ListDueReminders(ctx, now))
+		if len(dueList) != 2 || dueList[0].ID != other.ID || dueList[1].ID != due.ID {
+			t.Fatalf("ListDueReminders = %+v", dueList)
+		}
+
+		check(t, s.UpdateReminderNext(ctx, due.ID, now.Add(2*time.Hour)))
+		if dueList := must[[]ReminderRecord](t)(s.ListDueReminders(ctx, now)); len(dueList) != 1 {
+			t.Fatalf("ListDueReminders after UpdateReminderNext returned %d reminders, want 1", len(dueList))
+		}
+
+		if err := s.DeleteReminder(ctx, 2, due.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("DeleteReminder of another user: err = %v, want ErrNotFound", err)
+		}
+		check(t, s.DeleteReminder(ctx, 1, due.ID))
+	})
+}
+
+func TestStoreSchedules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		now := time.Now()
+		later := &ScheduleRecord{UserID: 1, Spec: "@daily", Prompt: "later", NextAt: now.Add(time.Hour)}
+		due := &ScheduleRecord{UserID: 1, Spec: "@hourly", Prompt: "due", NextAt: now.Add(-time.Minute)}
+		for _, r := range []*ScheduleRecord{later, due} {
+			check(t, s.CreateSchedule(ctx, r))
+		}
+
+		if schedules := must[[]ScheduleRecord](t)(s.ListSchedules(ctx, 1)); len(schedules) != 2 || schedules[0].ID != due.ID {
+			t.Fatalf("ListSchedules = %+v, want sorted by NextAt", schedules)
+		}
+		if n := must[int64](t)(s.CountSchedules(ctx, 1)); n != 2 {
+			t.Fatalf("CountSchedules = %d, want 2", n)
+		}
+		if dueList := must[[]ScheduleRecord](t)(s.ListDueSchedules(ctx, now)); len(dueList) != 1 || dueList[0].ID != due.ID {
+			t.Fatalf("ListDueSchedules = %+v", dueList)
+		}
+
+		check(t, s.UpdateScheduleNext(ctx, due.ID, now.Add(2*time.Hour)))
+		if dueList := must[[]ScheduleRecord](t)(s.ListDueSchedules(ctx, now)); len(dueList) != 0 {
+			t.Fatal("ListDueSchedules returned a schedule after UpdateScheduleNext")
+		}
+
+		if err := s.DeleteSchedule(ctx, 2, due.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("DeleteSchedule of another user: err = %v, want ErrNotFound", err)
+		}
+		check(t, s.DeleteSchedule(ctx, 1, due.ID))
+	})
+}
+
+func TestStoreAudits(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		for _, action := range []string{"a", "b", "c"} {
+			check(t, s.CreateAudit(ctx, &AuditRecord{ActorID: 1, Action: action, Outcome: AuditSuccess}))
+		}
+
+		audits := must[[]AuditRecord](t)(s.ListRecentAudits(ctx, 2))
+		if len(audits) != 2 || audits[0].Action != "c" || audits[1].Action != "b" {
+			t.Fatalf("ListRecentAudits(2) = %+v, want newest first", audits)
+		}
+
+		if n := must[int64](t)(s.PurgeAudits(ctx, time.Now().Add(-time.Minute))); n != 0 {
+			t.Fatalf("PurgeAudits deleted %d recent audits", n)
+		}
+		if n := must[int64](t)(s.PurgeAudits(ctx, time.Now().Add(time.Minute))); n != 3 {
+			t.Fatalf("PurgeAudits = %d, want 3", n)
+		}
+	})
+}
+
+func TestStoreRewriteEncryptedFields(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		check(t, s.CreateMemory(ctx, 1, "plain"))
+		check(t, s.CreateMemory(ctx, 1, "enc:done"))
+		check(t, s.CreateRound(ctx, newTestRound(1, time.Time{}, "hello", "")))
+		check(t, s.CreateReminder(ctx, &ReminderRecord{UserID: 1, Text: "reminder", NextAt: time.Now()}))
+		check(t, s.CreateSchedule(ctx, &ScheduleRecord{UserID: 1, Spec: "@daily", Prompt: "prompt", NextAt: time.Now()}))
+
+		rewrite := func(v string) (string, error) { return "enc:" + v, nil }
+		// memory + message content + reminder + schedule, 空值和已有前缀的值不改写
+		if n := must[int64](t)(s.RewriteEncryptedFields(ctx, "enc:", rewrite)); n != 4 {
+			t.Fatalf("RewriteEncryptedFields = %d, want 4", n)
+		}
+		if n := must[int64](t)(s.RewriteEncryptedFields(ctx, "enc:", rewrite)); n != 0 {
+			t.Fatalf("second RewriteEncryptedFields = %d, want 0", n)
+		}
+
+		for _, m := range must[[]MemoryRecord](t)(s.ListMemories(ctx, 1)) {
+			if m.Memory != "enc:plain" && m.Memory != "enc:done" {
+				t.Fatalf("memory after rewrite = %q", m.Memory)
+			}
+		}
+		round := must[RoundRecord](t)(s.GetLastRound(ctx, 1))
+		if round.Messages[0].Content != "enc:hello" || round.Messages[1].Content != "" {
+			t.Fatalf("messages after rewrite = %+v", round.Messages)
+		}
+		if reminders := must[[]ReminderRecord](t)(s.ListReminders(ctx, 1)); !strings.HasPrefix(reminders[0].Text, "enc:") {
+			t.Fatalf("reminder after rewrite = %q", reminders[0].Text)
+		}
+		if schedules := must[[]ScheduleRecord](t)(s.ListSchedules(ctx, 1)); !strings.HasPrefix(schedules[0].Prompt, "enc:") {
+			t.Fatalf("schedule after rewrite = %q", schedules[0].Prompt)
+		}
+	})
+}
@@ -0,0 +1,397 @@
+package atri
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStore 包装另一个Store, 为每次调用创建一个Span
+type tracedStore struct {
+	Store
+	tracer trace.Tracer
+}
+
+// newTracedStore 创建一个记录链路追踪的Store
+func newTracedStore(store Store, tracer trace.Tracer) Store {
+	return &tracedStore{Store: store, tracer: tracer}
+}
+
+// traced 在Span中执行一次Store调用, ErrNotFound属于正常结果, 不会被记录为错误
+func traced[T any](ctx context.Context, s *tracedStore, method string, fn func(context.Context) (T, error)) (T, error) {
+	ctx, span := s.tracer.Start(ctx, "store."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("atri.store.method", method)),
+	)
+
+	res, err := fn(ctx)
+	if errors.Is(err, ErrNotFound) {
+		endSpan(span, nil)
+	} else {
+		endSpan(span, err)
+	}
+	return res, err
+}
+
+// tracedErr 是traced的只返回error的版本
+func tracedErr(ctx context.Context, s *tracedStore, method string, fn func(context.Context) error) error {
+	_, err := traced(ctx, s, method, func(ctx context.Context) (struct{}, error) { return struct{}{}, fn(ctx) })
+	return err
+}
+
+func (s *tracedStore) Migrate(ctx context.Context) error {
+	return tracedErr(ctx, s, "Migrate", func(ctx context.Context) error {
+		return s.Store.Migrate(ctx)
+	})
+}
+
+func (s *tracedStore) RewriteEncryptedFields(ctx context.Context, skipPrefix string, rewrite func(string) (string, error)) (int64, error) {
+	return traced(ctx, s, "RewriteEncryptedFields", func(ctx context.Context) (int64, error) {
+		return s.Store.RewriteEncryptedFields(ctx, skipPrefix, rewrite)
+	})
+}
+
+func (s *tracedStore) HasAnyUser(ctx context.Context) (bool, error) {
+	return traced(ctx, s, "HasAnyUser", func(ctx context.Context) (bool, error) {
+		return s.Store.HasAnyUser(ctx)
+	})
+}
+
+func (s *tracedStore) GetUser(ctx context.Context, userID int64) (AllowedUserRecord, error) {
+	return traced(ctx, s, "GetUser", func(ctx context.Context) (AllowedUserRecord, error) {
+		return s.Store.GetUser(ctx, userID)
+	})
+}
+
+func (s *tracedStore) CreateUser(ctx context.Context, userID int64, isAdmin bool) error {
+	return tracedErr(ctx, s, "CreateUser", func(ctx context.Context) error {
+		return s.Store.CreateUser(ctx, userID, isAdmin)
+	})
+}
+
+func (s *tracedStore) DeleteUser(ctx context.Context, userID int64) error {
+	return tracedErr(ctx, s, "DeleteUser", func(ctx context.Context) error {
+		return s.Store.DeleteUser(ctx, userID)
+	})
+}
+
+func (s *tracedStore) DeleteUserData(ctx context.Context, userID int64) error {
+	return tracedErr(ctx, s, "DeleteUserData", func(ctx context.Context) error {
+		return s.Store.DeleteUserData(ctx, userID)
+	})
+}
+
+func (s *tracedStore) ListUsers(ctx context.Context) ([]AllowedUserRecord, error) {
+	return traced(ctx, s, "ListUsers", func(ctx context.Context) ([]AllowedUserRecord, error) {
+		return s.Store.ListUsers(ctx)
+	})
+}
+
+func (s *tracedStore) ListUsersPage(ctx context.Context, offset int, limit int) ([]AllowedUserRecord, error) {
+	return traced(ctx, s, "ListUsersPage", func(ctx context.Context) ([]AllowedUserRecord, error) {
+		return s.Store.ListUsersPage(ctx, offset, limit)
+	})
+}
+
+func (s *tracedStore) CountUsers(ctx context.Context) (int64, error) {
+	return traced(ctx, s, "CountUsers", func(ctx context.Context) (int64, error) {
+		return s.Store.CountUsers(ctx)
+	})
+}
+
+func (s *tracedStore) ListAdmins(ctx context.Context) ([]AllowedUserRecord, error) {
+	return traced(ctx, s, "ListAdmins", func(ctx context.Context) ([]AllowedUserRecord, error) {
+		return s.Store.ListAdmins(ctx)
+	})
+}
+
+func (s *tracedStore) UpdateUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	return tracedErr(ctx, s, "UpdateUserAdmin", func(ctx context.Context) error {
+		return s.Store.UpdateUserAdmin(ctx, userID, isAdmin)
+	})
+}
+
+func (s *tracedStore) UpdateUserRole(ctx context.Context, userID int64, role string) error {
+	return tracedErr(ctx, s, "UpdateUserRole", func(ctx context.Context) error {
+		return s.Store.UpdateUserRole(ctx, userID, role)
+	})
+}
+
+func (s *tracedStore) ListMemories(ctx context.Context, userID int64) ([]MemoryRecord, error) {
+	return traced(ctx, s, "ListMemories", func(ctx context.Context) ([]MemoryRecord, error) {
+		return s.Store.ListMemories(ctx, userID)
+	})
+}
+
+func (s *tracedStore) ListMemoriesPage(ctx context.Context, userID int64, offset int, limit int) ([]MemoryRecord, error) {
+	return traced(ctx, s, "ListMemoriesPage", func(ctx context.Context) ([]MemoryRecord, error) {
+		return s.Store.ListMemoriesPage(ctx, userID, offset, limit)
+	})
+}
+
+func (s *tracedStore) CountMemories(ctx context.Context, userID int64) (int64, error) {
+	return traced(ctx, s, "CountMemories", func(ctx context.Context) (int64, error) {
+		return s.Store.CountMemories(ctx, userID)
+	})
+}
+
+func (s *tracedStore) GetMemory(ctx context.Context, userID int64, memoryID uint) (MemoryRecord, error) {
+	return traced(ctx, s, "GetMemory", func(ctx context.Context) (MemoryRecord, error) {
+		return s.Store.GetMemory(ctx, userID, memoryID)
+	})
+}
+
+func (s *tracedStore) CreateMemory(ctx context.Context, userID int64, memory string) error {
+	return tracedErr(ctx, s, "CreateMemory", func(ctx context.Context) error {
+		return s.Store.CreateMemory(ctx, userID, memory)
+	})
+}
+
+func (s *tracedStore) DeleteMemory(ctx context.Context, userID int64, memoryID uint) error {
+	return tracedErr(ctx, s, "DeleteMemory", func(ctx context.Context) error {
+		return s.Store.DeleteMemory(ctx, userID, memoryID)
+	})
+}
+
+func (s *tracedStore) PurgeMemories(ctx context.Context, before time.Time) (int64, error) {
+	return traced(ctx, s, "PurgeMemories", func(ctx context.Context) (int64, error) {
+		return s.Store.PurgeMemories(ctx, before)
+	})
+}
+
+func (s *tracedStore) CreateRound(ctx context.Context, record *RoundRecord) error {
+	return tracedErr(ctx, s, "CreateRound", func(ctx context.Context) error {
+		return s.Store.CreateRound(ctx, record)
+	})
+}
+
+func (s *tracedStore) ListRecentRounds(ctx context.Context, userID int64, limit int) ([]RoundRecord, error) {
+	return traced(ctx, s, "ListRecentRounds", func(ctx context.Context) ([]RoundRecord, error) {
+		return s.Store.ListRecentRounds(ctx, userID, limit)
+	})
+}
+
+func (s *tracedStore) ListRoundsSince(ctx context.Context, userID int64, since time.Time) ([]RoundRecord, error) {
+	return traced(ctx, s, "ListRoundsSince", func(ctx context.Context) ([]RoundRecord, error) {
+		return s.Store.ListRoundsSince(ctx, userID, since)
+	})
+}
+
+func (s *tracedStore) GetLastRound(ctx context.Context, userID int64) (RoundRecord, error) {
+	return traced(ctx, s, "GetLastRound", func(ctx context.Context) (RoundRecord, error) {
+		return s.Store.GetLastRound(ctx, userID)
+	})
+}
+
+func (s *tracedStore) DeleteRound(ctx context.Context, userID int64, roundID uint) error {
+	return tracedErr(ctx, s, "DeleteRound", func(ctx context.Context) error {
+		return s.Store.DeleteRound(ctx, userID, roundID)
+	})
+}
+
+func (s *tracedStore) CountRounds(ctx context.Context, userID int64) (int64, error) {
+	return traced(ctx, s, "CountRounds", func(ctx context.Context) (int64, error) {
+		return s.Store.CountRounds(ctx, userID)
+	})
+}
+
+func (s *tracedStore) PurgeRounds(ctx context.Context, before time.Time, keep int) (int64, error) {
+	return traced(ctx, s, "PurgeRounds", func(ctx context.Context) (int64, error) {
+		return s.Store.PurgeRounds(ctx, before, keep)
+	})
+}
+
+func (s *tracedStore) SearchMessages(ctx context.Context, userID int64, query string, limit int) ([]MessageRecord, error) {
+	return traced(ctx, s, "SearchMessages", func(ctx context.Context) ([]MessageRecord, error) {
+		return s.Store.SearchMessages(ctx, userID, query, limit)
+	})
+}
+
+func (s *tracedStore) AddUsage(ctx context.Context, delta UsageRecord) error {
+	return tracedErr(ctx, s, "AddUsage", func(ctx context.Context) error {
+		return s.Store.AddUsage(ctx, delta)
+	})
+}
+
+func (s *tracedStore) ListUsageSince(ctx context.Context, userID int64, day string) ([]UsageRecord, error) {
+	return traced(ctx, s, "ListUsageSince", func(ctx context.Context) ([]UsageRecord, error) {
+		return s.Store.ListUsageSince(ctx, userID, day)
+	})
+}
+
+func (s *tracedStore) GetUserQuota(ctx context.Context, userID int64) (UserQuotaRecord, error) {
+	return traced(ctx, s, "GetUserQuota", func(ctx context.Context) (UserQuotaRecord, error) {
+		return s.Store.GetUserQuota(ctx, userID)
+	})
+}
+
+func (s *tracedStore) SaveUserQuota(ctx context.Context, record *UserQuotaRecord) error {
+	return tracedErr(ctx, s, "SaveUserQuota", func(ctx context.Context) error {
+		return s.Store.SaveUserQuota(ctx, record)
+	})
+}
+
+func (s *tracedStore) CreateInvite(ctx context.Context, invite *InviteRecord) error {
+	return tracedErr(ctx, s, "CreateInvite", func(ctx context.Context) error {
+		return s.Store.CreateInvite(ctx, invite)
+	})
+}
+
+func (s *tracedStore) ListInvites(ctx context.Context) ([]InviteRecord, error) {
+	return traced(ctx, s, "ListInvites", func(ctx context.Context) ([]InviteRecord, error) {
+		return s.Store.ListInvites(ctx)
+	})
+}
+
+func (s *tracedStore) RevokeInvite(ctx context.Context, code string) error {
+	return tracedErr(ctx, s, "RevokeInvite", func(ctx context.Context) error {
+		return s.Store.RevokeInvite(ctx, code)
+	})
+}
+
+func (s *tracedStore) RedeemInvite(ctx context.Context, code string, userID int64, now time.Time) (InviteRecord, error) {
+	return traced(ctx, s, "RedeemInvite", func(ctx context.Context) (InviteRecord, error) {
+		return s.Store.RedeemInvite(ctx, code, userID, now)
+	})
+}
+
+func (s *tracedStore) GetLastAccessRequest(ctx context.Context, userID int64) (AccessRequestRecord, error) {
+	return traced(ctx, s, "GetLastAccessRequest", func(ctx context.Context) (AccessRequestRecord, error) {
+		return s.Store.GetLastAccessRequest(ctx, userID)
+	})
+}
+
+func (s *tracedStore) CreateAccessRequest(ctx context.Context, request *AccessRequestRecord) error {
+	return tracedErr(ctx, s, "CreateAccessRequest", func(ctx context.Context) error {
+		return s.Store.CreateAccessRequest(ctx, request)
+	})
+}
+
+func (s *tracedStore) DecideAccessRequest(ctx context.Context, requestID uint, adminID int64, approve bool) (AccessRequestRecord, error) {
+	return traced(ctx, s, "DecideAccessRequest", func(ctx context.Context) (AccessRequestRecord, error) {
+		return s.Store.DecideAccessRequest(ctx, requestID, adminID, approve)
+	})
+}
+
+func (s *tracedStore) GetActiveBan(ctx context.Context, userID int64, now time.Time) (BanRecord, error) {
+	return traced(ctx, s, "GetActiveBan", func(ctx context.Context) (BanRecord, error) {
+		return s.Store.GetActiveBan(ctx, userID, now)
+	})
+}
+
+func (s *tracedStore) SaveBan(ctx context.Context, ban *BanRecord) error {
+	return tracedErr(ctx, s, "SaveBan", func(ctx context.Context) error {
+		return s.Store.SaveBan(ctx, ban)
+	})
+}
+
+func (s *tracedStore) DeleteBan(ctx context.Context, userID int64) error {
+	return tracedErr(ctx, s, "DeleteBan", func(ctx context.Context) error {
+		return s.Store.DeleteBan(ctx, userID)
+	})
+}
+
+func (s *tracedStore) ListActiveBans(ctx context.Context, now time.Time) ([]BanRecord, error) {
+	return traced(ctx, s, "ListActiveBans", func(ctx context.Context) ([]BanRecord, error) {
+		return s.Store.ListActiveBans(ctx, now)
+	})
+}
+
+func (s *tracedStore) CreateReminder(ctx context.Context, reminder *ReminderRecord) error {
+	return tracedErr(ctx, s, "CreateReminder", func(ctx context.Context) error {
+		return s.Store.CreateReminder(ctx, reminder)
+	})
+}
+
+func (s *tracedStore) ListReminders(ctx context.Context, userID int64) ([]ReminderRecord, error) {
+	return traced(ctx, s, "ListReminders", func(ctx context.Context) ([]ReminderRecord, error) {
+		return s.Store.ListReminders(ctx, userID)
+	})
+}
+
+func (s *tracedStore) DeleteReminder(ctx context.Context, userID int64, reminderID uint) error {
+	return tracedErr(ctx, s, "DeleteReminder", func(ctx context.Context) error {
+		return s.Store.DeleteReminder(ctx, userID, reminderID)
+	})
+}
+
+func (s *tracedStore) ListDueReminders(ctx context.Context, now time.Time) ([]ReminderRecord, error) {
+	return traced(ctx, s, "ListDueReminders", func(ctx context.Context) ([]ReminderRecord, error) {
+		return s.Store.ListDueReminders(ctx, now)
+	})
+}
+
+func (s *tracedStore) UpdateReminderNext(ctx context.Context, reminderID uint, next time.Time) error {
+	return tracedErr(ctx, s, "UpdateReminderNext", func(ctx context.Context) error {
+		return s.Store.UpdateReminderNext(ctx, reminderID, next)
+	})
+}
+
+func (s *tracedStore) CreateSchedule(ctx context.Context, schedule *ScheduleRecord) error {
+	return tracedErr(ctx, s, "CreateSchedule", func(ctx context.Context) error {
+		return s.Store.CreateSchedule(ctx, schedule)
+	})
+}
+
+func (s *tracedStore) ListSchedules(ctx context.Context, userID int64) ([]ScheduleRecord, error) {
+	return traced(ctx, s, "ListSchedules", func(ctx context.Context) ([]ScheduleRecord, error) {
+		return s.Store.ListSchedules(ctx, userID)
+	})
+}
+
+func (s *tracedStore) CountSchedules(ctx context.Context, userID int64) (int64, error) {
+	return traced(ctx, s, "CountSchedules", func(ctx context.Context) (int64, error) {
+		return s.Store.CountSchedules(ctx, userID)
+	})
+}
+
+func (s *tracedStore) DeleteSchedule(ctx context.Context, userID int64, scheduleID uint) error {
+	return tracedErr(ctx, s, "DeleteSchedule", func(ctx context.Context) error {
+		return s.Store.DeleteSchedule(ctx, userID, scheduleID)
+	})
+}
+
+func (s *tracedStore) ListDueSchedules(ctx context.Context, now time.Time) ([]ScheduleRecord, error) {
+	return traced(ctx, s, "ListDueSchedules", func(ctx context.Context) ([]ScheduleRecord, error) {
+		return s.Store.ListDueSchedules(ctx, now)
+	})
+}
+
+func (s *tracedStore) UpdateScheduleNext(ctx context.Context, scheduleID uint, next time.Time) error {
+	return tracedErr(ctx, s, "UpdateScheduleNext", func(ctx context.Context) error {
+		return s.Store.UpdateScheduleNext(ctx, scheduleID, next)
+	})
+}
+
+func (s *tracedStore) GetUserSettings(ctx context.Context, userID int64) (UserSettingsRecord, error) {
+	return traced(ctx, s, "GetUserSettings", func(ctx context.Context) (UserSettingsRecord, error) {
+		return s.Store.GetUserSettings(ctx, userID)
+	})
+}
+
+func (s *tracedStore) SaveUserSettings(ctx context.Context, record *UserSettingsRecord) error {
+	return tracedErr(ctx, s, "SaveUserSettings", func(ctx context.Context) error {
+		return s.Store.SaveUserSettings(ctx, record)
+	})
+}
+
+func (s *tracedStore) CreateAudit(ctx context.Context, record *AuditRecord) error {
+	return tracedErr(ctx, s, "CreateAudit", func(ctx context.Context) error {
+		return s.Store.CreateAudit(ctx, record)
+	})
+}
+
+func (s *tracedStore) ListRecentAudits(ctx context.Context, limit int) ([]AuditRecord, error) {
+	return traced(ctx, s, "ListRecentAudits", func(ctx context.Context) ([]AuditRecord, error) {
+		return s.Store.ListRecentAudits(ctx, limit)
+	})
+}
+
+func (s *tracedStore) PurgeAudits(ctx context.Context, before time.Time) (int64, error) {
+	return traced(ctx, s, "PurgeAudits", func(ctx context.Context) (int64, error) {
+		return s.Store.PurgeAudits(ctx, before)
+	})
+}
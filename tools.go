@@ -3,17 +3,24 @@ package atri
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/shared"
 	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.uber.org/zap"
 )
 
-// getTools 获取所有可用的工具定义
-func (a *Atri) getTools() []openai.ChatCompletionToolUnionParam {
-	return []openai.ChatCompletionToolUnionParam{
+// getTools 获取用户可用的工具定义, 没有使用工具的权限时返回nil
+func (a *Atri) getTools(ctx context.Context, userID int64) []openai.ChatCompletionToolUnionParam {
+	if !a.hasPermission(ctx, userID, PermUseTools) {
+		return nil
+	}
+
+	tools := []openai.ChatCompletionToolUnionParam{
 		openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
 			Name:        "create_memory",
 			Description: openai.String("创建一个记忆。它接受一个参数，参数的内容即为所需要记忆的内容。"),
@@ -28,21 +35,95 @@ func (a *Atri) getTools() []openai.ChatCompletionToolUnionParam {
 			},
 		}),
 	}
+
+	tools = append(tools, openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name:        "create_reminder",
+		Description: openai.String("创建一个提醒, 到时间后会把提醒内容发送给用户。用户要求在某个时间提醒他时使用。"),
+		Parameters: j{
+			"type": "object",
+			"properties": j{
+				"time": j{
+					"type":        "string",
+					"description": "提醒的时间, 格式为\"2006-01-02 15:04\", 使用用户的时区(即当前时间所在的时区)",
+				},
+				"text": j{
+					"type":        "string",
+					"description": "提醒的内容",
+				},
+				"recurrence": j{
+					"type":        "string",
+					"enum":        []string{"none", RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly},
+					"description": "重复方式, 默认为none(只提醒一次)",
+				},
+			},
+			"required": []string{"time", "text"},
+		},
+	}))
+
+	if a.config.EnableSearchTool {
+		tools = append(tools, openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+			Name:        "search_history",
+			Description: openai.String("在与当前用户的全部历史对话中查找包含关键词的消息, 可以用来回忆很久以前聊过的内容。返回消息的时间和摘要。"),
+			Parameters: j{
+				"type": "object",
+				"properties": j{
+					"query": j{
+						"type":        "string",
+						"description": "要查找的关键词",
+					},
+					"limit": j{
+						"type":        "integer",
+						"description": "最多返回的结果数, 默认为5",
+					},
+				},
+				"required": []string{"query"},
+			},
+		}))
+	}
+
+	return tools
 }
 
 // handleToolCall 处理工具调用分发
 func (a *Atri) handleToolCall(ctx context.Context, bt *bot.Bot, userID int64, toolCall openai.FinishedChatCompletionToolCall) openai.ChatCompletionMessageParamUnion {
 	handlers := map[string]func(context.Context, *bot.Bot, int64, string, string) openai.ChatCompletionMessageParamUnion{
-		"create_memory": a.handleCreateMemoryTool,
+		"create_memory":   a.handleCreateMemoryTool,
+		"search_history":  a.handleSearchHistoryTool,
+		"create_reminder": a.handleCreateReminderTool,
 	}
 
 	callID := toolCall.ID
 	callData := toolCall.Arguments
 
+	ctx, span := a.startSpan(ctx, "atri.tool",
+		attrUserID.Int64(userID),
+		attribute.String("tool.name", toolCall.Name),
+		attribute.String("tool.call_id", callID),
+	)
+	defer span.End()
+
+	if !a.hasPermission(ctx, userID, PermUseTools) {
+		span.SetStatus(codes.Error, "没有使用工具的权限")
+		a.metrics.toolCalls.WithLabelValues(toolCall.Name, "denied").Inc()
+		return openai.ToolMessage("错误: 用户没有使用工具的权限.", callID)
+	}
+
 	if handler, ok := handlers[toolCall.Name]; ok {
-		return handler(ctx, bt, userID, callID, callData)
+		result := handler(ctx, bt, userID, callID, callData)
+
+		outcome := "success"
+		if text := messageText(result); strings.HasPrefix(text, "错误") {
+			outcome = "error"
+			span.SetStatus(codes.Error, text)
+		}
+		span.SetAttributes(attribute.String("tool.outcome", outcome))
+		a.metrics.toolCalls.WithLabelValues(toolCall.Name, outcome).Inc()
+
+		return result
 	}
 
+	span.SetStatus(codes.Error, "工具不存在")
+	a.metrics.toolCalls.WithLabelValues("unknown", "error").Inc()
 	a.logger.Warn("调用了一个不存在的工具", zap.String("Name", toolCall.Name))
 	return openai.ToolMessage("错误: 工具不存在.", callID)
 }
@@ -55,7 +136,7 @@ func (a *Atri) handleCreateMemoryTool(ctx context.Context, _ *bot.Bot, userID in
 	}
 	memory := what.String()
 
-	err := a.createMemory(ctx, userID, memory)
+	err := a.store.CreateMemory(ctx, userID, memory)
 	if err != nil {
 		a.logger.Error("存储记忆失败!", zap.Error(err))
 		return openai.ToolMessage(fmt.Sprintf("错误: 记忆\"%s\"存储失败. %s", memory, err), callID)
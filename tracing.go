@@ -0,0 +1,73 @@
+package atri
+
+import (
+	"context"
+
+	"github.com/go-telegram/bot/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName 是Atri创建Tracer时使用的名字
+const tracerName = "github.com/chhongzh/atri-core"
+
+// 链路追踪中使用的属性
+var (
+	attrUserID = attribute.Key("atri.user_id")
+	attrChatID = attribute.Key("atri.chat_id")
+)
+
+// newTracer 使用配置的TracerProvider创建Tracer, 未配置时使用全局的TracerProvider(默认不导出任何数据)
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan 开始一个Span, 需要配合endSpan使用
+func (a *Atri) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return a.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan 结束Span, err不为nil时将其记录在Span上
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// updateAttributes 取出更新中的用户和聊天, 用作Span的属性
+func updateAttributes(update *models.Update) []attribute.KeyValue {
+	var from *models.User
+	var chat *models.Chat
+
+	switch {
+	case update.Message != nil:
+		from, chat = update.Message.From, &update.Message.Chat
+	case update.EditedMessage != nil:
+		from, chat = update.EditedMessage.From, &update.EditedMessage.Chat
+	case update.CallbackQuery != nil:
+		from = &update.CallbackQuery.From
+		if update.CallbackQuery.Message.Message != nil {
+			chat = &update.CallbackQuery.Message.Message.Chat
+		}
+	case update.MyChatMember != nil:
+		from, chat = &update.MyChatMember.From, &update.MyChatMember.Chat
+	case update.InlineQuery != nil:
+		from = update.InlineQuery.From
+	}
+
+	attrs := []attribute.KeyValue{attribute.Int64("telegram.update_id", update.ID)}
+	if from != nil {
+		attrs = append(attrs, attrUserID.Int64(from.ID))
+	}
+	if chat != nil {
+		attrs = append(attrs, attrChatID.Int64(chat.ID))
+	}
+	return attrs
+}
@@ -2,15 +2,22 @@ package atri
 
 import (
 	"context"
+	"sync"
 
 	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 	"github.com/openai/openai-go/v3"
 )
 
 type roundHistory = []openai.ChatCompletionMessageParamUnion
 type j = map[string]any
 type userSession struct {
-	currentRole string
-	histories   []roundHistory
+	// lock 保护以下字段, 只在读写时短暂持有
+	lock           sync.Mutex
+	loaded         bool // 是否已从数据库加载History
+	currentRole    string
+	histories      []roundHistory
+	awaitingImport bool // 用户发送了 /import, 正在等待文件
 }
 type commandHandlerFunc = func(context.Context, *bot.Bot, int64, int64, []string) error
+type callbackHandlerFunc = func(context.Context, *bot.Bot, *models.CallbackQuery, callbackData) (string, error)
@@ -0,0 +1,108 @@
+package atri
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// usageSummary 是一段时间内的用量汇总
+type usageSummary struct {
+	Rounds           int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+func (s *usageSummary) add(r UsageRecord) {
+	s.Rounds += r.Rounds
+	s.PromptTokens += r.PromptTokens
+	s.CompletionTokens += r.CompletionTokens
+	s.Cost += r.Cost
+}
+
+// describeUsage 以当前用户的语言描述用量
+func (a *Atri) describeUsage(ctx context.Context, s usageSummary) string {
+	return a.t(ctx, "usage.summary", s.Rounds, s.PromptTokens, s.CompletionTokens, s.Cost)
+}
+
+// calcCost 根据价格表计算费用
+func (a *Atri) calcCost(model string, promptTokens int64, completionTokens int64) float64 {
+	price, ok := a.config.Prices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1_000_000
+}
+
+// summarizeUsageSince 汇总某个用户从某天开始的用量
+func (a *Atri) summarizeUsageSince(ctx context.Context, userID int64, since time.Time) (usageSummary, error) {
+	records, err := a.loadUsageSince(ctx, userID, since)
+	if err != nil {
+		return usageSummary{}, err
+	}
+
+	summary := usageSummary{}
+	for _, r := range records {
+		summary.add(r)
+	}
+	return summary, nil
+}
+
+func (a *Atri) handleUsage(ctx context.Context, bt *bot.Bot, chatID int64, userID int64, args []string) error {
+	if !a.requirePermission(ctx, userID, PermViewUsage, "usage") {
+		_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "no_permission_command"), false)
+		return err
+	}
+
+	days := 30
+	if len(args) >= 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			_, err := a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "usage.usage"), false)
+			return err
+		}
+		days = n
+	}
+
+	since := time.Now().AddDate(0, 0, -(days - 1))
+	records, err := a.loadUsageSince(ctx, 0, since)
+	if err != nil {
+		return err
+	}
+
+	perUser := map[int64]*usageSummary{}
+	total := usageSummary{}
+	for _, r := range records {
+		s, ok := perUser[r.UserID]
+		if !ok {
+			s = &usageSummary{}
+			perUser[r.UserID] = s
+		}
+		s.add(r)
+		total.add(r)
+	}
+
+	userIDs := make([]int64, 0, len(perUser))
+	for id := range perUser {
+		userIDs = append(userIDs, id)
+	}
+	slices.Sort(userIDs)
+
+	var sb strings.Builder
+	for _, id := range userIDs {
+		fmt.Fprintf(&sb, "ID: %d - %s\n", id, a.describeUsage(ctx, *perUser[id]))
+	}
+
+	if sb.Len() == 0 {
+		sb.WriteString(a.t(ctx, "usage.empty"))
+	}
+
+	_, err = a.sendMessageTo(ctx, bt, chatID, a.t(ctx, "usage.list", days, sb.String(), a.describeUsage(ctx, total)), false)
+	return err
+}
@@ -2,8 +2,12 @@ package atri
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/openai/openai-go/v3"
@@ -11,33 +15,27 @@ import (
 	"go.uber.org/zap"
 )
 
-// buildSystemPromptMessage 构建系统提示词消息
-func (a *Atri) buildSystemPromptMessage(ctx context.Context, prompt string, userID int64, username string) (openai.ChatCompletionMessageParamUnion, error) {
-	memoryRecords, err := a.loadMemories(ctx, userID)
-	if err != nil {
-		return openai.ChatCompletionMessageParamUnion{}, err
-	}
-	memories := []string{}
-	for _, record := range memoryRecords {
-		memories = append(memories, record.String())
-	}
-
-	prompt = strings.ReplaceAll(prompt, "{{USERNAME}}", username)
-	prompt = strings.ReplaceAll(prompt, "{{MEMORIES}}", strings.Join(memories, "\n"))
-
-	return openai.SystemMessage(prompt), nil
-}
-
 // buildUserMessage 构建用户消息
 func (a *Atri) buildUserMessage(chatText string) openai.ChatCompletionMessageParamUnion {
 	chatText = strings.TrimSpace(chatText)
 	return openai.UserMessage(chatText)
 }
 
-// buildTimeSystemMessage 构建当前时间的系统消息
-func (a *Atri) buildTimeSystemMessage() openai.ChatCompletionMessageParamUnion {
-	now := time.Now()
-	content := fmt.Sprintf("当前的时间是:%s", now.Format(time.DateTime))
+// userTextOfRound 取出一轮对话中用户发送的文本
+func userTextOfRound(round roundHistory) string {
+	for _, msg := range round {
+		if isUserMessage(msg) {
+			return messageText(msg)
+		}
+	}
+	return ""
+}
+
+// buildTimeSystemMessage 构建用户所在时区的当前时间的系统消息
+func (a *Atri) buildTimeSystemMessage(loc *time.Location) openai.ChatCompletionMessageParamUnion {
+	now := time.Now().In(loc)
+	weekdays := []string{"日", "一", "二", "三", "四", "五", "六"}
+	content := fmt.Sprintf("当前的时间是:%s 星期%s (时区: %s)", now.Format(time.DateTime), weekdays[now.Weekday()], loc)
 	return openai.SystemMessage(content)
 }
 
@@ -55,21 +53,67 @@ func (a *Atri) assertAndGetToolArgument(callID string, callData string, paramPat
 	return param, openai.ChatCompletionMessageParamUnion{}, true
 }
 
-// getSessionOrInit 获取或初始化用户会话
+// chatLock 返回用户的对话锁, 在整轮对话期间持有, 保证同一用户的对话依次进行, 不同用户的对话互不阻塞
+func (a *Atri) chatLock(userID int64) *sync.Mutex {
+	a.userSessionLock.Lock()
+	defer a.userSessionLock.Unlock()
+
+	lock, ok := a.userChatLocks[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		a.userChatLocks[userID] = lock
+	}
+	return lock
+}
+
+// getSessionOrInit 获取或初始化用户会话, 首次获取时从数据库加载History
 func (a *Atri) getSessionOrInit(ctx context.Context, userID int64) *userSession {
 	a.userSessionLock.Lock()
 	session, ok := a.userSession[userID]
 	if !ok {
 		session = &userSession{}
 		a.userSession[userID] = session
+		a.updateSessionGauge()
+	}
+	a.userSessionLock.Unlock()
 
-		// 加载History
+	// 加载History时只锁住这个用户的会话, 不阻塞其他用户
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if !session.loaded {
 		err := a.fillSessionHistoryFromDB(ctx, session, userID)
 		if err != nil {
 			a.logger.Error("填充History错误!", zap.Error(err))
 		}
+		session.loaded = true
 	}
-	a.userSessionLock.Unlock()
 
 	return session
 }
+
+// parseDuration 解析时长, 在time.ParseDuration的基础上支持以d结尾的天数
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("无效的天数: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("时长必须大于0: %s", s)
+	}
+	return d, nil
+}
+
+// randomToken 生成指定字节数的随机十六进制字符串
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
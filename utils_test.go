@@ -0,0 +1,35 @@
+package atri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestChatLockSurvivesSessionReset(t *testing.T) {
+	ctx := context.Background()
+	a := New(ctx, zap.NewNop(), nil, NewMemoryStore(), "", Config{})
+
+	// 模拟一轮正在进行的对话
+	lock := a.chatLock(1)
+	lock.Lock()
+	a.getSessionOrInit(ctx, 1)
+
+	a.resetSession(1)
+	if a.chatLock(1).TryLock() {
+		t.Fatal("resetting the session released the chat lock of a running chat")
+	}
+	if !a.chatLock(2).TryLock() {
+		t.Fatal("a running chat blocked another user")
+	}
+
+	// 对话结束前保存的一轮在会话重新加载时可见
+	check(t, a.store.CreateRound(ctx, newTestRound(1, time.Time{}, "hello", "hi")))
+	lock.Unlock()
+
+	if session := a.getSessionOrInit(ctx, 1); len(session.histories) != 1 {
+		t.Fatalf("reloaded session has %d rounds, want 1", len(session.histories))
+	}
+}